@@ -2,6 +2,9 @@ package app
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
+	"os"
 
 	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
 )
@@ -10,20 +13,45 @@ type App struct {
 	Ctx       context.Context
 	Config    *Config
 	GitlabCli *gitlab.GitlabClient
+	Project   *gitlab.Project
+	Out       Output
+	Log       *slog.Logger
+	// Results of the jobs, summarized at the end of a run.
+	Report *Report
 }
 
-func NewApp(ctx context.Context) (*App, error) {
-	config, err := parseFlags()
+func NewApp(ctx context.Context, config *Config) (*App, error) {
+	out := NewOutput(config.Output, os.Stdout)
+	app := &App{
+		Ctx:    ctx,
+		Config: config,
+		Out:    out,
+		Log:    NewLogger(config, LogWriter(out, os.Stderr)),
+		Report: NewReport(config.Policy, config.OptionalJobs),
+	}
+	cache, err := config.Cache()
 	if err != nil {
 		return nil, err
 	}
-	gitlabCli, err := gitlab.NewClient(config.Token, config.BaseURL)
+	gitlabCli, err := gitlab.NewClient(
+		config.BaseURL,
+		gitlab.WithCredentials(config.Credentials()...),
+		gitlab.WithLogger(app.Log),
+		gitlab.WithObserver(outputObserver{app}),
+		gitlab.WithTraceLines(config.TraceLines),
+		gitlab.WithRetryPolicy(config.RetryPolicy()),
+		gitlab.WithRateLimiter(config.RateLimiter()),
+		gitlab.WithBandwidthLimiter(config.BandwidthLimiter()),
+		gitlab.WithTransportConfig(config.Transport()),
+		gitlab.WithCache(cache),
+	)
 	if err != nil {
 		return nil, err
 	}
-	return &App{
-		Ctx:       ctx,
-		Config:    config,
-		GitlabCli: gitlabCli,
-	}, nil
+	project, err := gitlabCli.ResolveProject(config.ProjectRef())
+	if err != nil {
+		return nil, fmt.Errorf("project %q: %w", config.ProjectRef(), err)
+	}
+	app.GitlabCli, app.Project = gitlabCli, project
+	return app, nil
 }
@@ -0,0 +1,53 @@
+package app
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+func isInsideCI(environment map[string]string) bool {
+	return environment["GITLAB_CI"] == "true"
+}
+
+// environment returns the process environment as a map.
+func environment() map[string]string {
+	environment := make(map[string]string)
+	for _, keyValue := range os.Environ() {
+		key, value, _ := strings.Cut(keyValue, "=")
+		environment[key] = value
+	}
+	return environment
+}
+
+// applyCIDefaults fills the settings that are not set explicitly from the
+// predefined variables of the GitLab CI job the tool runs in. CI_JOB_TOKEN
+// is the last resort of resolveToken.
+func applyCIDefaults(cfg *Config, environment map[string]string) {
+	if !isInsideCI(environment) {
+		return
+	}
+
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = environment["CI_SERVER_URL"]
+	}
+	if cfg.Project == "" {
+		if cfg.Repository != "" {
+			// GAD_REPO alone names a sibling project of the same namespace.
+			cfg.Project = environment["CI_PROJECT_NAMESPACE"]
+		} else {
+			cfg.Project = environment["CI_PROJECT_ID"]
+		}
+	}
+	if cfg.Branch == "" {
+		cfg.Branch = environment["CI_COMMIT_REF_NAME"]
+	}
+}
+
+// currentPipelineID returns the ID of the pipeline the CI job belongs to.
+func currentPipelineID(environment map[string]string) (int, error) {
+	if !isInsideCI(environment) {
+		return 0, errNotInsideCI
+	}
+	return strconv.Atoi(environment["CI_PIPELINE_ID"])
+}
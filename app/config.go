@@ -3,70 +3,515 @@ package app
 import (
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
 	"github.com/caarlos0/env/v6"
+	"gopkg.in/yaml.v3"
 )
 
 const (
-	defaultTimeoutSeconds = 1800 // 3 minutes
+	defaultTimeout = 30 * time.Minute
+	defaultFolder  = "."
+	// Lines of the log shown for a failed job.
+	defaultTraceLines = 20
 )
 
+// Config is the effective configuration. Every setting is taken from, in
+// order of precedence: flags, GAD_* env variables, the chosen profile of the
+// configuration file, GitLab CI predefined variables and the defaults.
 type Config struct {
-	Project    string `env:"GAD_PROJECT,notEmpty"`
-	Branch     string `env:"GAD_BRANCH,notEmpty"`
-	BaseURL    string `env:"GAD_URL,notEmpty"`
-	Token      string `env:"GAD_TOKEN,notEmpty"`
-	Repository string `env:"GAD_REPO,notEmpty"`
-
-	Jobs      []string
-	Folder    string
-	KeyValues map[string]string
+	Project    string `env:"GAD_PROJECT"`
+	Branch     string `env:"GAD_BRANCH"`
+	BaseURL    string `env:"GAD_URL"`
+	Token      string `env:"GAD_TOKEN"`
+	Repository string `env:"GAD_REPO"`
+
+	Auth         gitlab.AuthMode `env:"GAD_AUTH"`
+	TriggerToken string          `env:"GAD_TRIGGER_TOKEN"`
+	TokenFile    string          `env:"GAD_TOKEN_FILE"`
+	TokenHelper  string          `env:"GAD_TOKEN_HELPER"`
+	TokenKeyring bool            `env:"GAD_TOKEN_KEYRING"`
+	// OAuth2 application used by the login command.
+	OAuthClientID string `env:"GAD_OAUTH_CLIENT_ID"`
+	// Where the token was taken from, reported instead of the token itself.
+	TokenSource string
+	// OAuth2 token stored by the login command, refreshed when it expires.
+	login     *storedLogin
+	loginPath string
+
+	Jobs      []string          `env:"GAD_JOBS"`
+	Folder    string            `env:"GAD_FOLDER"`
+	KeyValues map[string]string `env:"GAD_VARIABLES"`
+	Inputs    map[string]interface{}
 	Timeout   time.Duration
+
+	// Jobs marked with a trailing "?", their artifacts are not required.
+	OptionalJobs []string
+	Policy       Policy `env:"GAD_POLICY"`
+	// Lines of the log of a failed job to show, none when 0.
+	TraceLines int `env:"GAD_TRACE_LINES"`
+
+	// Retries of a failed request and the backoff between them.
+	Retries      int           `env:"GAD_RETRIES"`
+	RetryWaitMin time.Duration `env:"GAD_RETRY_WAIT_MIN"`
+	RetryWaitMax time.Duration `env:"GAD_RETRY_WAIT_MAX"`
+	// Requests per second sent to GitLab by the whole run, unlimited when 0.
+	RateLimit float64 `env:"GAD_RATE_LIMIT"`
+	RateBurst int     `env:"GAD_RATE_BURST"`
+
+	// Artifacts downloaded at once and the bytes per second they share,
+	// unlimited when 0.
+	Concurrency    int       `env:"GAD_CONCURRENCY"`
+	BandwidthLimit Bandwidth `env:"GAD_BANDWIDTH_LIMIT"`
+	// Which ready artifact is downloaded first.
+	DownloadOrder DownloadOrder `env:"GAD_DOWNLOAD_ORDER"`
+
+	// Directory GitLab responses are cached in across runs. They are only
+	// cached for the run when empty.
+	CacheDir string `env:"GAD_CACHE_DIR"`
+
+	// Connection to GitLab, see gitlab.TransportConfig.
+	CAFile             string `env:"GAD_CA_FILE"`
+	ClientCert         string `env:"GAD_CLIENT_CERT"`
+	ClientKey          string `env:"GAD_CLIENT_KEY"`
+	Proxy              string `env:"GAD_PROXY"`
+	UnixSocket         string `env:"GAD_UNIX_SOCKET"`
+	InsecureSkipVerify bool   `env:"GAD_INSECURE_SKIP_VERIFY"`
+
+	// Set when artifacts are collected from an already running pipeline.
+	PipelineID    int
+	SkipPreflight bool
+	DryRun        bool
+	// Output format, text or json.
+	Output string `env:"GAD_OUTPUT"`
+	// Lowest level of the logs written to stderr.
+	LogLevel slog.Level `env:"GAD_LOG_LEVEL"`
+
+	// Profile and file the configuration was loaded from, if any.
+	Profile     string
+	ProfileFile string
+}
+
+// listFlag collects the values of a flag that may be repeated.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
 }
 
-func parseFlags() (*Config, error) {
-	usage := func() {
-		fmt.Println("Dowloader of gitlab-ci artifacts.")
-		flag.PrintDefaults()
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// LoadConfig registers the shared flags on the flag set, which may already
+// hold command specific ones, and builds the configuration from the command
+// line arguments, the environment and the configuration file. It does not
+// check that all the required settings are present, see Validate.
+func LoadConfig(flags *flag.FlagSet, args []string) (*Config, error) {
+	configPath := flags.String("config", "", "[optional] Configuration file with profiles.")
+	profileName := flags.String("profile", "", "[optional] Profile of the configuration file to use.")
+
+	jobs := flags.String("j", "", "List of jobs to extract artifacts from.")
+	folder := flags.String("f", "", "Folder to download artifacts in. Default: .")
+
+	// Optional params
+	keyValues := flags.String("kv", "", "[optional] Key:value list for a triggered pipeline")
+	timeout := flags.String("t", "", "[optional] Timeout seconds for artifacts download process. Default: 1800")
+	var inputs listFlag
+	flags.Var(&inputs, "in", "[optional] Pipeline input as name:value, may be repeated")
+	inputsFile := flags.String("inf", "", "[optional] YAML or JSON file with pipeline inputs")
+	noPreflight := flags.Bool("no-preflight", false, "[optional] Trigger the pipeline without checking the project, ref, token and jobs first")
+	dryRun := flags.Bool("dry-run", false, "[optional] Print the jobs that would be kept, canceled and downloaded without triggering anything")
+	quiet := flags.Bool("q", false, "[optional] Only log warnings and errors")
+	verbose := flags.Bool("v", false, "[optional] Log debug messages, HTTP requests among them")
+	traceLines := flags.Int("trace-lines", -1, "[optional] Lines of the log of a failed job to show, 0 for none. Default: 20")
+	retries := flags.Int("retries", -1, "[optional] Retries of a failed request, 0 for none. Default: 5")
+	rateLimit := flags.Float64("rate-limit", 0, "[optional] Requests per second sent to GitLab, 0 for unlimited. Default: unlimited")
+	concurrency := flags.Int("concurrency", 0, "[optional] Artifacts downloaded at once, 0 for the default. Default: 4")
+	bandwidthLimit := flags.String("bandwidth-limit", "", "[optional] Bytes per second shared by the downloads, e.g. 512K or 10M. Default: unlimited")
+	downloadOrder := flags.String("download-order", "", "[optional] Ready artifacts downloaded first: ready, smallest or listed. Default: ready")
+	insecure := flags.Bool("insecure-skip-verify", false, "[optional] Accept any GitLab certificate, for labs only")
+	policy := flags.String("policy", "", "[optional] Artifacts needed for success: all, any or atLeast=N. Default: all")
+	output := flags.String("output", "", "[optional] Output format, text or json. Default: text")
+	current := flags.Bool("current", false, "[optional] Collect artifacts from the pipeline of the running CI job instead of triggering one")
+
+	if err := flags.Parse(args); err != nil {
+		return nil, err
 	}
-	flag.Usage = usage
+	// Flags whose zero value is a setting, e.g. -rate-limit=0 for unlimited.
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
 
-	cfg := Config{}
+	// Zero trace lines and retries are valid settings, the defaults are set
+	// up front.
+	cfg := Config{
+		TraceLines:   defaultTraceLines,
+		Retries:      gitlab.DefaultRetryPolicy.MaxRetries,
+		RetryWaitMin: gitlab.DefaultRetryPolicy.WaitMin,
+		RetryWaitMax: gitlab.DefaultRetryPolicy.WaitMax,
+	}
+	environment := environment()
 
-	if err := env.Parse(&cfg); err != nil {
-		usage()
+	if *configPath == "" {
+		*configPath = environment["GAD_CONFIG"]
+	}
+	if *profileName == "" {
+		*profileName = environment["GAD_PROFILE"]
+	}
+	profile, name, path, err := loadProfile(*configPath, *profileName)
+	if err != nil {
 		return nil, err
 	}
+	if profile != nil {
+		if err := profile.apply(&cfg, name, environment); err != nil {
+			return nil, err
+		}
+		cfg.Profile, cfg.ProfileFile = name, path
+	}
 
-	jobs := flag.String("j", "", "List of jobs to extract artifacts from.")
-	folder := flag.String("f", ".", "Folder to download artifacts in.")
+	if tokenSourceSelected(environment) {
+		// The profile's token source is replaced as a whole.
+		cfg.Token, cfg.TokenFile, cfg.TokenHelper, cfg.TokenKeyring = "", "", "", false
+		cfg.TokenSource = ""
+	}
+	if err := env.Parse(&cfg, env.Options{Environment: environment}); err != nil {
+		return nil, err
+	}
+	if environment["GAD_TOKEN"] != "" {
+		cfg.TokenSource = "env GAD_TOKEN"
+	}
+	if value := environment["GAD_TIMEOUT"]; value != "" {
+		if cfg.Timeout, err = parseTimeout(value); err != nil {
+			return nil, err
+		}
+	}
 
-	// Optional params
-	keyValues := flag.String("kv", "", "[optional] Key:value list for a triggered pipeline")
-	timeout := flag.Duration("t", defaultTimeoutSeconds, "[optional] Timeout seconds for artifacts download process.")
+	applyCIDefaults(&cfg, environment)
+	if err := resolveToken(&cfg, environment); err != nil {
+		return nil, err
+	}
 
-	flag.Parse()
+	if *jobs != "" {
+		cfg.Jobs = strings.Split(*jobs, ",")
+	}
+	if *folder != "" {
+		cfg.Folder = *folder
+	}
+	if *keyValues != "" {
+		if cfg.KeyValues, err = parseKeyValues(*keyValues); err != nil {
+			return nil, err
+		}
+	}
+	if *timeout != "" {
+		if cfg.Timeout, err = parseTimeout(*timeout); err != nil {
+			return nil, err
+		}
+	}
+	if *traceLines >= 0 {
+		cfg.TraceLines = *traceLines
+	}
+	if *retries >= 0 {
+		cfg.Retries = *retries
+	}
+	if set["rate-limit"] {
+		cfg.RateLimit = *rateLimit
+	}
+	if set["concurrency"] {
+		cfg.Concurrency = *concurrency
+	}
+	if *bandwidthLimit != "" {
+		if cfg.BandwidthLimit, err = ParseBandwidth(*bandwidthLimit); err != nil {
+			return nil, err
+		}
+	}
+	if *downloadOrder != "" {
+		if cfg.DownloadOrder, err = ParseDownloadOrder(*downloadOrder); err != nil {
+			return nil, err
+		}
+	}
+	if *policy != "" {
+		if cfg.Policy, err = ParsePolicy(*policy); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Inputs, err = parseInputs(cfg.Inputs, inputs, *inputsFile); err != nil {
+		return nil, err
+	}
+	if *insecure {
+		cfg.InsecureSkipVerify = true
+	}
+	cfg.SkipPreflight = *noPreflight
+	cfg.DryRun = *dryRun
+	if *output != "" {
+		cfg.Output = *output
+	}
+	switch {
+	case *verbose:
+		cfg.LogLevel = slog.LevelDebug
+	case *quiet:
+		cfg.LogLevel = slog.LevelWarn
+	}
+	if *current {
+		if cfg.PipelineID, err = currentPipelineID(environment); err != nil {
+			return nil, err
+		}
+	}
 
-	if *jobs == "" || *folder == "" {
-		usage()
-		return nil, errNotAllRequiredFlagsSet
+	if cfg.Auth == "" {
+		cfg.Auth = gitlab.AuthPersonalToken
+	}
+	if cfg.Folder == "" {
+		cfg.Folder = defaultFolder
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.Output == "" {
+		cfg.Output = OutputText
+	}
+	if cfg.Policy.Kind == "" {
+		cfg.Policy.Kind = PolicyAll
+	}
+	if cfg.Concurrency == 0 {
+		cfg.Concurrency = defaultConcurrency
 	}
+	if cfg.DownloadOrder == "" {
+		cfg.DownloadOrder = OrderReady
+	}
+	cfg.Jobs, cfg.OptionalJobs = splitOptionalJobs(cfg.Jobs)
+	if cfg.Retries < 0 || cfg.RetryWaitMin < 0 || cfg.RetryWaitMax < cfg.RetryWaitMin {
+		return nil, fmt.Errorf("%w: %d retries, waiting %s to %s", errInvalidRetries, cfg.Retries, cfg.RetryWaitMin, cfg.RetryWaitMax)
+	}
+	if cfg.RateLimit < 0 || cfg.RateBurst < 0 {
+		return nil, fmt.Errorf("%w: %g per second, bursts of %d", errInvalidRateLimit, cfg.RateLimit, cfg.RateBurst)
+	}
+	if cfg.Concurrency < 1 {
+		return nil, fmt.Errorf("%w: %d", errInvalidConcurrency, cfg.Concurrency)
+	}
+	if cfg.Output != OutputText && cfg.Output != OutputJSON {
+		return nil, fmt.Errorf("%w: %q", errInvalidOutput, cfg.Output)
+	}
+
+	return &cfg, nil
+}
+
+// RetryPolicy returns how failed requests are retried.
+func (cfg *Config) RetryPolicy() gitlab.RetryPolicy {
+	policy := gitlab.DefaultRetryPolicy
+	policy.MaxRetries = cfg.Retries
+	policy.WaitMin, policy.WaitMax = cfg.RetryWaitMin, cfg.RetryWaitMax
+	return policy
+}
+
+// RateLimiter returns the limiter shared by all the requests of the run.
+func (cfg *Config) RateLimiter() *gitlab.RateLimiter {
+	return gitlab.NewRateLimiter(cfg.RateLimit, cfg.RateBurst)
+}
+
+// Cache returns the cache of the GitLab responses. A dry run keeps it in
+// memory, it writes no file.
+func (cfg *Config) Cache() (gitlab.Cache, error) {
+	if cfg.CacheDir == "" || cfg.DryRun {
+		return gitlab.NewMemoryCache(), nil
+	}
+	return gitlab.NewDiskCache(cfg.CacheDir)
+}
+
+// Transport returns how to connect to GitLab.
+func (cfg *Config) Transport() gitlab.TransportConfig {
+	return gitlab.TransportConfig{
+		CAFile:             cfg.CAFile,
+		CertFile:           cfg.ClientCert,
+		KeyFile:            cfg.ClientKey,
+		ProxyURL:           cfg.Proxy,
+		UnixSocket:         cfg.UnixSocket,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+}
+
+// JSONOutput tells whether stdout carries JSON events, see Output.
+func (cfg *Config) JSONOutput() bool {
+	return cfg.Output == OutputJSON
+}
+
+// Validate reports all the settings needed to talk to GitLab that are missing
+// at once. The extra ones name the settings required by a particular command.
+func (cfg *Config) Validate(extra ...string) error {
+	missing := make([]string, 0)
+	if cfg.BaseURL == "" {
+		missing = append(missing, "GAD_URL")
+	}
+	if cfg.ProjectRef() == "" {
+		missing = append(missing, "GAD_PROJECT")
+	}
+	if cfg.Token == "" && cfg.TriggerToken == "" {
+		missing = append(missing, "a token")
+	}
+	for _, name := range extra {
+		switch {
+		case name == "GAD_BRANCH" && cfg.Branch == "" && cfg.PipelineID == 0:
+			missing = append(missing, name)
+		case name == "-j" && len(cfg.Jobs) == 0:
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) != 0 {
+		return fmt.Errorf("%w: %s", errNotAllRequiredFlagsSet, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// parseTimeout accepts a number of seconds or a duration like `30m`.
+func parseTimeout(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", errInvalidTimeout, value)
+	}
+	return timeout, nil
+}
 
-	jobsList := strings.Split(*jobs, ",")
+func parseKeyValues(keyValues string) (map[string]string, error) {
 	keyValuesMap := make(map[string]string)
-	if keyValuesList := strings.Split(*keyValues, ","); len(keyValuesList) > 1 {
-		for _, keyValue := range keyValuesList {
-			kv := strings.Split(keyValue, ":")
-			keyValuesMap[kv[0]] = kv[1]
+	for _, keyValue := range strings.Split(keyValues, ",") {
+		kv := strings.SplitN(keyValue, ":", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("%w: %q", errInvalidKeyValue, keyValue)
 		}
+		keyValuesMap[kv[0]] = kv[1]
 	}
+	return keyValuesMap, nil
+}
 
-	cfg.Jobs = jobsList
-	cfg.Folder = *folder
-	cfg.KeyValues = keyValuesMap
-	cfg.Timeout = *timeout * time.Second
+// parseInputs merges the inputs of the profile, the file and the flags, in
+// increasing order of precedence. Flag values stay strings and get their
+// types from the project's inputs spec later.
+func parseInputs(
+	profileInputs map[string]interface{},
+	inputs []string,
+	inputsFile string,
+) (map[string]interface{}, error) {
+	inputsMap := make(map[string]interface{})
+	for name, value := range profileInputs {
+		inputsMap[name] = value
+	}
+	if inputsFile != "" {
+		content, err := os.ReadFile(inputsFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(content, &inputsMap); err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidInputsFile, err)
+		}
+	}
+	for _, input := range inputs {
+		nameValue := strings.SplitN(input, ":", 2)
+		if len(nameValue) != 2 || nameValue[0] == "" {
+			return nil, fmt.Errorf("%w: %q", errInvalidInputFlag, input)
+		}
+		inputsMap[nameValue[0]] = nameValue[1]
+	}
+	return inputsMap, nil
+}
 
-	return &cfg, nil
+// ProjectRef returns the project's numeric ID or full path. GAD_REPO is
+// still accepted as the last path segment for older setups.
+func (cfg *Config) ProjectRef() string {
+	if cfg.Repository == "" {
+		return cfg.Project
+	}
+	return fmt.Sprintf("%s/%s", strings.TrimSuffix(cfg.Project, "/"), cfg.Repository)
+}
+
+// Credentials lists the configured tokens, the API one goes first.
+func (cfg *Config) Credentials() []*gitlab.Credentials {
+	creds := make([]*gitlab.Credentials, 0, 2)
+	if cfg.Token != "" {
+		apiCreds := &gitlab.Credentials{Mode: cfg.Auth, Token: cfg.Token}
+		if cfg.login != nil {
+			apiCreds.TokenSource = cfg.loginTokenSource()
+		}
+		creds = append(creds, apiCreds)
+	}
+	if cfg.TriggerToken != "" {
+		creds = append(creds, &gitlab.Credentials{Mode: gitlab.AuthTriggerToken, Token: cfg.TriggerToken})
+	}
+	return creds
+}
+
+// Show prints the effective configuration in the profile format with the
+// secrets masked.
+func (cfg *Config) Show(w io.Writer) error {
+	if cfg.Profile != "" {
+		fmt.Fprintf(w, "# profile %q from %s\n", cfg.Profile, cfg.ProfileFile)
+	}
+	if cfg.TokenSource != "" {
+		fmt.Fprintf(w, "# token from %s\n", cfg.TokenSource)
+	}
+	effective := &Profile{
+		URL:          cfg.BaseURL,
+		Auth:         string(cfg.Auth),
+		Token:        maskSecret(cfg.Token),
+		TriggerToken: maskSecret(cfg.TriggerToken),
+		Project:      cfg.ProjectRef(),
+		Branch:       cfg.Branch,
+		Jobs:         cfg.markedJobs(),
+		Policy:       cfg.Policy.String(),
+		Retries:      &cfg.Retries,
+		RetryWaitMin: cfg.RetryWaitMin.String(),
+		RetryWaitMax: cfg.RetryWaitMax.String(),
+		RateLimit:    cfg.RateLimit,
+		RateBurst:    cfg.RateBurst,
+		Concurrency:  cfg.Concurrency,
+		Bandwidth:    bandwidthString(cfg.BandwidthLimit),
+		Order:        string(cfg.DownloadOrder),
+		CacheDir:     cfg.CacheDir,
+		CAFile:       cfg.CAFile,
+		ClientCert:   cfg.ClientCert,
+		ClientKey:    cfg.ClientKey,
+		Proxy:        maskProxy(cfg.Proxy),
+		UnixSocket:   cfg.UnixSocket,
+		Insecure:     cfg.InsecureSkipVerify,
+		Folder:       cfg.Folder,
+		Variables:    cfg.KeyValues,
+		Inputs:       cfg.Inputs,
+		Timeout:      cfg.Timeout.String(),
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(effective); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// maskProxy hides the password of a proxy URL.
+func maskProxy(proxy string) string {
+	u, err := url.Parse(proxy)
+	if err != nil || u.User == nil {
+		return proxy
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), maskSecret("x"))
+	}
+	return u.String()
+}
+
+func maskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "********"
 }
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testProfiles = `profiles:
+  default:
+    url: https://gitlab.example.com
+    token_env: WORK_GITLAB_TOKEN
+    folder: ./profile
+    rate_limit: 5
+    concurrency: 2
+`
+
+// loadTestConfig loads the configuration from the profiles file, the env
+// variables and the flags, away from the settings of the user.
+func loadTestConfig(t *testing.T, environment map[string]string, args ...string) (*Config, error) {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(path, []byte(testProfiles), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("GLAB_CONFIG_DIR", dir)
+	t.Setenv("GAD_CREDENTIALS_FILE", filepath.Join(dir, "credentials.json"))
+	t.Setenv("WORK_GITLAB_TOKEN", "profile-token")
+	for key, value := range environment {
+		t.Setenv(key, value)
+	}
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	return LoadConfig(flags, append([]string{"-config", path}, args...))
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	tests := []struct {
+		name        string
+		environment map[string]string
+		args        []string
+		folder      string
+		rateLimit   float64
+		concurrency int
+	}{
+		{"profile", nil, nil, "./profile", 5, 2},
+		{"env over profile", map[string]string{"GAD_FOLDER": "./env", "GAD_RATE_LIMIT": "3", "GAD_CONCURRENCY": "3"}, nil, "./env", 3, 3},
+		{
+			"flags over env",
+			map[string]string{"GAD_FOLDER": "./env", "GAD_RATE_LIMIT": "3", "GAD_CONCURRENCY": "3"},
+			[]string{"-f", "./flag", "-rate-limit", "1", "-concurrency", "1"},
+			"./flag", 1, 1,
+		},
+		// Zero sets the rate back to unlimited and the downloads to the default.
+		{"zero flags", nil, []string{"-rate-limit", "0", "-concurrency", "0"}, "./profile", 0, defaultConcurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadTestConfig(t, tt.environment, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Folder != tt.folder || cfg.RateLimit != tt.rateLimit || cfg.Concurrency != tt.concurrency {
+				t.Errorf("folder %s, %g requests per second, %d downloads, want %s, %g, %d",
+					cfg.Folder, cfg.RateLimit, cfg.Concurrency, tt.folder, tt.rateLimit, tt.concurrency)
+			}
+		})
+	}
+}
+
+func TestConfigTokenSource(t *testing.T) {
+	tests := []struct {
+		name        string
+		environment map[string]string
+		token       string
+		source      string
+		err         error
+	}{
+		{"profile variable", nil, "profile-token", "env WORK_GITLAB_TOKEN", nil},
+		{"GAD_TOKEN", map[string]string{"GAD_TOKEN": "env-token"}, "env-token", "env GAD_TOKEN", nil},
+		// The keyring is not chosen, the profile's source stays.
+		{"keyring off", map[string]string{"GAD_TOKEN_KEYRING": "false"}, "profile-token", "env WORK_GITLAB_TOKEN", nil},
+		{"unset variable", map[string]string{"WORK_GITLAB_TOKEN": ""}, "", "", errTokenEnvUnset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadTestConfig(t, tt.environment)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if cfg.Token != tt.token || cfg.TokenSource != tt.source {
+				t.Errorf("token %q from %q, want %q from %q", cfg.Token, cfg.TokenSource, tt.token, tt.source)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
+)
+
+// Artifacts downloaded at once by default.
+const defaultConcurrency = 4
+
+const (
+	// Artifacts are downloaded as their jobs finish.
+	OrderReady = "ready"
+	// The smallest ready artifact is downloaded first.
+	OrderSmallest = "smallest"
+	// Ready artifacts are downloaded in the order of the jobs list.
+	OrderListed = "listed"
+)
+
+// DownloadOrder decides which of the ready artifacts is downloaded first
+// when all the downloads are busy.
+type DownloadOrder string
+
+func ParseDownloadOrder(value string) (DownloadOrder, error) {
+	switch value {
+	case "", OrderReady:
+		return OrderReady, nil
+	case OrderSmallest, OrderListed:
+		return DownloadOrder(value), nil
+	}
+	return "", fmt.Errorf("%w: %q", errInvalidDownloadOrder, value)
+}
+
+func (o *DownloadOrder) UnmarshalText(text []byte) error {
+	order, err := ParseDownloadOrder(string(text))
+	if err != nil {
+		return err
+	}
+	*o = order
+	return nil
+}
+
+// Bandwidth is a number of bytes per second.
+type Bandwidth int64
+
+var bandwidthUnits = []struct {
+	suffix string
+	size   int64
+}{{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}}
+
+// ParseBandwidth accepts bytes per second with an optional K, M or G suffix,
+// e.g. 512K or 10M.
+func ParseBandwidth(value string) (Bandwidth, error) {
+	number, unit := strings.ToUpper(value), int64(1)
+	for _, u := range bandwidthUnits {
+		if trimmed, ok := strings.CutSuffix(number, u.suffix); ok {
+			number, unit = trimmed, u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%w: %q", errInvalidBandwidth, value)
+	}
+	return Bandwidth(n * unit), nil
+}
+
+func (b *Bandwidth) UnmarshalText(text []byte) error {
+	bandwidth, err := ParseBandwidth(string(text))
+	if err != nil {
+		return err
+	}
+	*b = bandwidth
+	return nil
+}
+
+func (b Bandwidth) String() string {
+	for _, u := range bandwidthUnits {
+		if b != 0 && int64(b)%u.size == 0 {
+			return strconv.FormatInt(int64(b)/u.size, 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(int64(b), 10)
+}
+
+// BandwidthLimiter returns the limiter shared by all the downloads of the run.
+func (cfg *Config) BandwidthLimiter() *gitlab.BandwidthLimiter {
+	return gitlab.NewBandwidthLimiter(int64(cfg.BandwidthLimit))
+}
+
+// DownloadFirst tells whether the artifact of a goes before the one of b
+// when both are ready. Artifacts of an unknown size count as the smallest.
+func (cfg *Config) DownloadFirst(a, b *gitlab.JobInfo) bool {
+	switch cfg.DownloadOrder {
+	case OrderSmallest:
+		return a.ArtifactSize < b.ArtifactSize
+	case OrderListed:
+		return cfg.jobIndex(a.Name) < cfg.jobIndex(b.Name)
+	}
+	return false
+}
+
+// jobIndex returns the position of the job in the jobs list.
+func (cfg *Config) jobIndex(name string) int {
+	for i, job := range cfg.Jobs {
+		if job == name {
+			return i
+		}
+	}
+	return len(cfg.Jobs)
+}
+
+// bandwidthString leaves an unlimited bandwidth out of the profile format.
+func bandwidthString(b Bandwidth) string {
+	if b == 0 {
+		return ""
+	}
+	return b.String()
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
+)
+
+// DryRun prints what a run would trigger, cancel and download. The jobs are
+// predicted with the CI lint simulation; no pipeline is created and nothing
+// is written to the filesystem.
+func (app *App) DryRun(pipeline *gitlab.PipelineInfo, cancelUnneededJobs bool, out io.Writer) error {
+	fmt.Fprintln(out, "Dry run, no pipeline is triggered and no file is written.")
+	fmt.Fprintf(out, "Project: %s (ID %d)\n", app.Project, app.Project.ID)
+	fmt.Fprintf(out, "Ref: %s\n", pipeline.Branch)
+	for _, key := range sortedKeys(pipeline.KeyVals) {
+		fmt.Fprintf(out, "Variable: %s=%s\n", key, pipeline.KeyVals[key])
+	}
+	for _, name := range sortedKeys(pipeline.Inputs) {
+		fmt.Fprintf(out, "Input: %s=%v\n", name, pipeline.Inputs[name])
+	}
+
+	jobs, atLeast := app.Config.PreflightJobs()
+	report := app.GitlabCli.Preflight(pipeline, jobs, atLeast)
+	for _, warning := range report.Warnings {
+		fmt.Fprintf(out, "Warning: %s\n", warning)
+	}
+
+	wanted := make(map[string]bool, len(app.Config.Jobs))
+	for _, job := range app.Config.Jobs {
+		wanted[job] = true
+	}
+	fmt.Fprintf(out, "Jobs the pipeline would create: %d\n", len(report.Jobs))
+	for _, job := range report.Jobs {
+		switch {
+		case wanted[job.Name]:
+			fmt.Fprintf(out, "  keep      %s -> %s\n", job.Name, gitlab.ArtifactPath(app.Config.Folder, job.Name))
+		case cancelUnneededJobs:
+			fmt.Fprintf(out, "  cancel    %s\n", job.Name)
+		default:
+			fmt.Fprintf(out, "  ignore    %s\n", job.Name)
+		}
+	}
+
+	return report.Err()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -3,5 +3,24 @@ package app
 import "errors"
 
 var (
-	errNotAllRequiredFlagsSet = errors.New("not all required flags were specified")
-)
\ No newline at end of file
+	errNotAllRequiredFlagsSet = errors.New("not all required settings were specified")
+	errInvalidInputFlag       = errors.New("input flag must be in the name:value form")
+	errInvalidInputsFile      = errors.New("invalid inputs file")
+	errNotInsideCI            = errors.New("not running inside a GitLab CI job")
+	errInvalidKeyValue        = errors.New("variables must be in the key:value form")
+	errInvalidTimeout         = errors.New("timeout must be seconds or a duration")
+	errInvalidConfigFile      = errors.New("invalid configuration file")
+	errUnknownProfile         = errors.New("unknown profile")
+	errTokenSource            = errors.New("failed to read the token")
+	errTokenEnvUnset          = errors.New("token variable is not set")
+	errInvalidCredentialsFile = errors.New("invalid credentials file")
+	errLoginNotConfigured     = errors.New("login needs GAD_URL and GAD_OAUTH_CLIENT_ID")
+	errInvalidOutput          = errors.New("output must be text or json")
+	errInvalidPolicy          = errors.New("policy must be all, any or atLeast=N")
+	errPolicyNotMet           = errors.New("not enough artifacts were delivered")
+	errInvalidRetries         = errors.New("retries and their waits must not be negative, the minimum wait not above the maximum")
+	errInvalidRateLimit       = errors.New("rate limit and burst must not be negative")
+	errInvalidConcurrency     = errors.New("concurrency must be at least 1")
+	errInvalidBandwidth       = errors.New("bandwidth limit must be bytes per second, e.g. 512K or 10M")
+	errInvalidDownloadOrder   = errors.New("download order must be ready, smallest or listed")
+)
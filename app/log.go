@@ -0,0 +1,31 @@
+package app
+
+import (
+	"io"
+	"log/slog"
+)
+
+// NewLogger creates the logger of the app. Logs are text lines without the
+// time, or JSON objects along with the JSON output.
+func NewLogger(cfg *Config, w io.Writer) *slog.Logger {
+	options := &slog.HandlerOptions{Level: cfg.LogLevel}
+	if cfg.JSONOutput() {
+		return slog.New(slog.NewJSONHandler(w, options))
+	}
+	options.ReplaceAttr = func(groups []string, attr slog.Attr) slog.Attr {
+		if len(groups) == 0 && attr.Key == slog.TimeKey {
+			return slog.Attr{}
+		}
+		return attr
+	}
+	return slog.New(slog.NewTextHandler(w, options))
+}
+
+// LogWriter returns where the logs shown along with out are written to w, a
+// live view is kept clear of them.
+func LogWriter(out Output, w io.Writer) io.Writer {
+	if live, ok := out.(*liveOutput); ok {
+		return &liveLogWriter{live: live, w: w}
+	}
+	return w
+}
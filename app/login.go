@@ -0,0 +1,181 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
+	"golang.org/x/oauth2"
+)
+
+const (
+	defaultCredentialsFile = "credentials.json"
+	loginScope             = "api"
+)
+
+// storedLogin is the OAuth2 token of one GitLab instance kept in the
+// per-user credentials file.
+type storedLogin struct {
+	ClientID string        `json:"client_id"`
+	Token    *oauth2.Token `json:"token"`
+}
+
+func credentialsPath(environment map[string]string) string {
+	if path := environment["GAD_CREDENTIALS_FILE"]; path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, defaultConfigDir, defaultCredentialsFile)
+}
+
+// loadLogins reads the credentials file, a missing file holds no logins.
+func loadLogins(path string) (map[string]*storedLogin, error) {
+	logins := make(map[string]*storedLogin)
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return logins, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &logins); err != nil {
+		return nil, fmt.Errorf("%w %s: %w", errInvalidCredentialsFile, path, err)
+	}
+	return logins, nil
+}
+
+// saveLogin stores the login of the host, the file is only readable by the user.
+func saveLogin(path, host string, login *storedLogin) error {
+	logins, err := loadLogins(path)
+	if err != nil {
+		return err
+	}
+	logins[host] = login
+
+	content, err := json.MarshalIndent(logins, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// Written aside and renamed, a failed write or a concurrent refresh never
+	// leaves a truncated file. CreateTemp creates the file with 0600.
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func hostOf(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// Login runs the OAuth2 device authorization flow against the configured
+// GitLab instance and stores the tokens in the credentials file.
+func Login(ctx context.Context, cfg *Config, out io.Writer) error {
+	if cfg.BaseURL == "" || cfg.OAuthClientID == "" {
+		return errLoginNotConfigured
+	}
+
+	ctx, err := cfg.oauthContext(ctx)
+	if err != nil {
+		return err
+	}
+	oauthConfig := gitlab.OAuthConfig(cfg.BaseURL, cfg.OAuthClientID, loginScope)
+	auth, err := gitlab.AuthorizeDevice(ctx, oauthConfig)
+	if err != nil {
+		return err
+	}
+	verificationURI := auth.VerificationURIComplete
+	if verificationURI == "" {
+		verificationURI = auth.VerificationURI
+	}
+	fmt.Fprintf(out, "Open %s and enter the code %s.\n", verificationURI, auth.UserCode)
+
+	token, err := gitlab.WaitDeviceToken(ctx, oauthConfig, auth)
+	if err != nil {
+		return err
+	}
+	path := credentialsPath(environment())
+	if err := saveLogin(path, hostOf(cfg.BaseURL), &storedLogin{ClientID: cfg.OAuthClientID, Token: token}); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Logged in, the token was stored in %s.\n", path)
+	return nil
+}
+
+// oauthContext carries the HTTP client of the OAuth2 requests, which go
+// through the same TLS and proxy setup as the API ones.
+func (cfg *Config) oauthContext(ctx context.Context) (context.Context, error) {
+	transport, err := gitlab.NewTransport(cfg.Transport())
+	if err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: transport}), nil
+}
+
+// persistingTokenSource refreshes an expired token and writes the new one
+// back to the credentials file.
+type persistingTokenSource struct {
+	mu     sync.Mutex
+	source oauth2.TokenSource
+	path   string
+	host   string
+	login  *storedLogin
+}
+
+func (cfg *Config) loginTokenSource() oauth2.TokenSource {
+	// A broken transport config fails the creation of the client anyway.
+	ctx, _ := cfg.oauthContext(context.Background())
+	oauthConfig := gitlab.OAuthConfig(cfg.BaseURL, cfg.login.ClientID, loginScope)
+	return &persistingTokenSource{
+		source: oauthConfig.TokenSource(ctx, cfg.login.Token),
+		path:   cfg.loginPath,
+		host:   hostOf(cfg.BaseURL),
+		login:  cfg.login,
+	}
+}
+
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, err := s.source.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token.AccessToken != s.login.Token.AccessToken {
+		s.login = &storedLogin{ClientID: s.login.ClientID, Token: token}
+		if err := saveLogin(s.path, s.host, s.login); err != nil {
+			return nil, err
+		}
+	}
+	return token, nil
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestLoginTokenRefresh(t *testing.T) {
+	refreshes := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oauth/token" || r.FormValue("grant_type") != "refresh_token" || r.FormValue("refresh_token") != "old-refresh" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		refreshes++
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "new-access",
+			"token_type":    "Bearer",
+			"refresh_token": "new-refresh",
+			"expires_in":    7200,
+		})
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), defaultCredentialsFile)
+	expired := &oauth2.Token{AccessToken: "old-access", RefreshToken: "old-refresh", Expiry: time.Now().Add(-time.Minute)}
+	cfg := &Config{
+		BaseURL:   srv.URL + "/api/v4",
+		login:     &storedLogin{ClientID: "client", Token: expired},
+		loginPath: path,
+	}
+	source := cfg.loginTokenSource()
+	for i := 0; i < 2; i++ {
+		token, err := source.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.AccessToken != "new-access" {
+			t.Errorf("access token %q, want the refreshed one", token.AccessToken)
+		}
+	}
+	if refreshes != 1 {
+		t.Errorf("%d refreshes, want 1", refreshes)
+	}
+
+	logins, err := loadLogins(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := logins[hostOf(cfg.BaseURL)]
+	if stored == nil || stored.ClientID != "client" || stored.Token.AccessToken != "new-access" || stored.Token.RefreshToken != "new-refresh" {
+		t.Errorf("stored login = %+v, want the refreshed token", stored)
+	}
+}
+
+func TestSaveLoginReplacesTheFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, defaultCredentialsFile)
+	if err := os.WriteFile(path, []byte(`{"gitlab.example.com":{"client_id":"other"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	token := &oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}
+	if err := saveLogin(path, "gitlab.com", &storedLogin{ClientID: "client", Token: token}); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("permissions %v, want 0600", perm)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("%d files in the directory, want only the credentials file", len(entries))
+	}
+	logins, err := loadLogins(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logins["gitlab.example.com"] == nil || logins["gitlab.com"] == nil || logins["gitlab.com"].Token.AccessToken != "access" {
+		t.Errorf("logins = %+v, want both hosts", logins)
+	}
+}
@@ -0,0 +1,424 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
+)
+
+// OutputVersion is the version of the JSON events. It changes when a field is
+// removed or changes its meaning, new fields may be added without a change.
+const OutputVersion = 1
+
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// Types of the events.
+const (
+	EventPipelineCreated    = "pipeline_created"
+	EventPipelineUsed       = "pipeline_used"
+	EventPipelineCanceled   = "pipeline_canceled"
+	EventPipelineRetried    = "pipeline_retried"
+	EventJobFound           = "job_found"
+	EventJobStatus          = "job_status"
+	EventJobCanceled        = "job_canceled"
+	EventJobRetried         = "job_retried"
+	EventArtifactReady      = "artifact_ready"
+	EventArtifactDownloaded = "artifact_downloaded"
+	EventArtifactProgress   = "artifact_progress"
+	EventWaiting            = "waiting"
+	EventError              = "error"
+	EventSummary            = "summary"
+)
+
+// Event is a line of the JSON output.
+type Event struct {
+	Version  int            `json:"version"`
+	Time     time.Time      `json:"time"`
+	Type     string         `json:"event"`
+	Pipeline int            `json:"pipeline,omitempty"`
+	Job      *JobEvent      `json:"job,omitempty"`
+	Artifact *ArtifactEvent `json:"artifact,omitempty"`
+	Message  string         `json:"message,omitempty"`
+	Error    string         `json:"error,omitempty"`
+	Summary  *Summary       `json:"summary,omitempty"`
+	Trace    *TraceEvent    `json:"trace,omitempty"`
+	// Only shown by the text output, see jsonOutput.
+	Progress *ProgressEvent `json:"-"`
+
+	// Line of the text output, the event is not shown there when it is empty.
+	Text string `json:"-"`
+}
+
+type JobEvent struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	Stage        string `json:"stage,omitempty"`
+	Status       string `json:"status,omitempty"`
+	AllowFailure bool   `json:"allow_failure,omitempty"`
+	// Set for the failed jobs.
+	FailureReason string `json:"failure_reason,omitempty"`
+	WebURL        string `json:"web_url,omitempty"`
+}
+
+func newJobEvent(job *gitlab.JobInfo) *JobEvent {
+	return &JobEvent{
+		ID:            job.ID,
+		Name:          job.Name,
+		Stage:         job.Stage,
+		Status:        job.Status,
+		AllowFailure:  job.AllowFailure,
+		FailureReason: job.FailureReason,
+		WebURL:        job.WebURL,
+	}
+}
+
+type ArtifactEvent struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+func newArtifactEvent(file *gitlab.ArtifactFile) *ArtifactEvent {
+	if file == nil {
+		return nil
+	}
+	return &ArtifactEvent{
+		Path:   file.Path,
+		Size:   file.Size,
+		SHA256: file.SHA256,
+	}
+}
+
+// ProgressEvent tells how far the download of an artifact is, for the text
+// output.
+type ProgressEvent struct {
+	Bytes int64 `json:"bytes"`
+	// Size of the artifact, 0 when unknown.
+	TotalBytes int64 `json:"total_bytes,omitempty"`
+}
+
+// TraceEvent is the end of the log of a failed job.
+type TraceEvent struct {
+	FailedSection string      `json:"failed_section,omitempty"`
+	Lines         []TraceLine `json:"lines"`
+}
+
+type TraceLine struct {
+	Text    string `json:"text"`
+	Section string `json:"section,omitempty"`
+}
+
+func newTraceEvent(trace *gitlab.JobTrace) *TraceEvent {
+	event := &TraceEvent{FailedSection: trace.FailedSection, Lines: make([]TraceLine, 0, len(trace.Lines))}
+	for _, line := range trace.Lines {
+		event.Lines = append(event.Lines, TraceLine{Text: line.Text, Section: line.Section})
+	}
+	return event
+}
+
+// text renders the log under the error, the lines of the failed section are
+// marked with ">".
+func (e *TraceEvent) text(job string) string {
+	var b strings.Builder
+	if e.FailedSection != "" {
+		fmt.Fprintf(&b, "Last lines of the job %s log, it failed in %s:", job, e.FailedSection)
+	} else {
+		fmt.Fprintf(&b, "Last lines of the job %s log:", job)
+	}
+	for _, line := range e.Lines {
+		marker := "  "
+		if e.FailedSection != "" && line.Section == e.FailedSection {
+			marker = "> "
+		}
+		b.WriteString("\n" + marker + line.Text)
+	}
+	return b.String()
+}
+
+// Output shows the events either as text lines or as JSON ones. On a
+// terminal the text lines come with a live view of the jobs.
+type Output interface {
+	Emit(event *Event)
+}
+
+func NewOutput(format string, w io.Writer) Output {
+	if format == OutputJSON {
+		return &jsonOutput{enc: json.NewEncoder(w)}
+	}
+	if isTerminal(w) {
+		return newLiveOutput(w)
+	}
+	return &textOutput{w: w, progress: newProgress()}
+}
+
+// textOutput writes the text lines, the waiting ones tell the status of the
+// jobs which are not done with yet.
+type textOutput struct {
+	mu       sync.Mutex
+	w        io.Writer
+	progress *progress
+}
+
+func (o *textOutput) Emit(event *Event) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := time.Now()
+	o.progress.update(event, now)
+	text := event.Text
+	if event.Type == EventWaiting {
+		text = o.progress.status(now)
+	}
+	if text == "" {
+		return
+	}
+	fmt.Fprintln(o.w, text)
+}
+
+type jsonOutput struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (o *jsonOutput) Emit(event *Event) {
+	// The JSON stream has an event per state change, the download progress
+	// is for the text output only.
+	if event.Type == EventArtifactProgress {
+		return
+	}
+	event.Version = OutputVersion
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	_ = o.enc.Encode(event)
+}
+
+// outputObserver turns the job changes seen by the client into events.
+type outputObserver struct {
+	app *App
+}
+
+func (o outputObserver) JobStatusChanged(job *gitlab.JobInfo) {
+	o.app.Out.Emit(&Event{Type: EventJobStatus, Job: newJobEvent(job)})
+}
+
+func (o outputObserver) JobCanceled(job *gitlab.JobInfo, err error) {
+	o.app.JobCanceled(job, err)
+}
+
+func (o outputObserver) DownloadProgress(job *gitlab.JobInfo, read, total int64) {
+	o.app.Out.Emit(&Event{Type: EventArtifactProgress, Job: newJobEvent(job), Progress: &ProgressEvent{Bytes: read, TotalBytes: total}})
+}
+
+func (app *App) PipelineCreated(id int) {
+	app.Out.Emit(&Event{Type: EventPipelineCreated, Pipeline: id, Text: fmt.Sprintf("Pipeline %d was triggered.", id)})
+}
+
+func (app *App) PipelineUsed(id int) {
+	app.Out.Emit(&Event{Type: EventPipelineUsed, Pipeline: id, Text: fmt.Sprintf("Using the current pipeline %d.", id)})
+}
+
+func (app *App) PipelineCanceled(id int) {
+	app.Out.Emit(&Event{Type: EventPipelineCanceled, Pipeline: id, Text: fmt.Sprintf("Pipeline %d was canceled.", id)})
+}
+
+func (app *App) PipelineRetried(id int) {
+	app.Out.Emit(&Event{Type: EventPipelineRetried, Pipeline: id, Text: fmt.Sprintf("Failed jobs of the pipeline %d were retried.", id)})
+}
+
+// JobsFound emits an event per job, the text output has a single line.
+func (app *App) JobsFound(jobs []*gitlab.JobInfo) {
+	for i, job := range jobs {
+		event := &Event{Type: EventJobFound, Job: newJobEvent(job)}
+		if i == len(jobs)-1 {
+			event.Text = "Jobs were located."
+		}
+		app.Out.Emit(event)
+	}
+}
+
+// JobFinished reports the final status of a job that was waited for.
+func (app *App) JobFinished(job *gitlab.JobInfo) {
+	app.Out.Emit(&Event{Type: EventJobStatus, Job: newJobEvent(job), Text: fmt.Sprintf("Job %s finished with %s.", job.Name, job.Status)})
+}
+
+func (app *App) JobCanceled(job *gitlab.JobInfo, err error) {
+	event := &Event{Type: EventJobCanceled, Job: newJobEvent(job), Text: fmt.Sprintf("Job %s was canceled.", job.Name)}
+	if err != nil {
+		event.Error = err.Error()
+		event.Text = fmt.Sprintf("Failed to cancel job %s: %s", job.Name, err.Error())
+	}
+	app.Out.Emit(event)
+}
+
+// JobRetried reports the new job that retries the given one.
+func (app *App) JobRetried(job, retried *gitlab.JobInfo) {
+	app.Out.Emit(&Event{
+		Type:    EventJobRetried,
+		Job:     newJobEvent(retried),
+		Message: fmt.Sprintf("retry of the job %d", job.ID),
+		Text:    fmt.Sprintf("Job %s was retried as %d.", job.Name, retried.ID),
+	})
+}
+
+func (app *App) ArtifactReady(job *gitlab.JobInfo) {
+	app.Out.Emit(&Event{Type: EventArtifactReady, Job: newJobEvent(job), Text: fmt.Sprintf("Got artifact %s. Downloading...", job.Name)})
+}
+
+// ArtifactDownloaded reports the file the artifact of the job was written to.
+// The text line is the path alone when text is empty.
+func (app *App) ArtifactDownloaded(job *gitlab.JobInfo, file *gitlab.ArtifactFile, text string) {
+	if text == "" {
+		text = file.Path
+	}
+	app.Out.Emit(&Event{Type: EventArtifactDownloaded, Job: newJobEvent(job), Artifact: newArtifactEvent(file), Text: text})
+}
+
+func (app *App) Waiting() {
+	app.Out.Emit(&Event{Type: EventWaiting, Text: "Waiting..."})
+}
+
+// Error reports an error, job may be nil when it is not about a job.
+func (app *App) Error(job *gitlab.JobInfo, err error, text string) {
+	event := &Event{Type: EventError, Error: err.Error(), Text: text}
+	if job != nil {
+		event.Job = newJobEvent(job)
+	}
+	var failed *gitlab.JobFailedError
+	if errors.As(err, &failed) && failed.Trace != nil && len(failed.Trace.Lines) != 0 {
+		event.Trace = newTraceEvent(failed.Trace)
+		event.Text += "\n" + event.Trace.text(failed.Job.Name)
+	}
+	app.Out.Emit(event)
+}
+
+// Summarize emits the summary of the run, err is the error it stopped with.
+func (app *App) Summarize(err error) {
+	summary := app.Report.Finish(err)
+	event := &Event{Type: EventSummary, Summary: summary}
+	switch {
+	case err != nil:
+	case !summary.Success:
+		event.Text = fmt.Sprintf("Work is finished, %d of %d artifacts were not downloaded, the %s policy is not met.", summary.Failed, len(summary.Jobs), summary.Policy)
+	case summary.Failed != 0:
+		event.Text = fmt.Sprintf("Work is finished, %d of %d artifacts were not downloaded, the %s policy is met.", summary.Failed, len(summary.Jobs), summary.Policy)
+	default:
+		event.Text = "Work is finished."
+	}
+	app.Out.Emit(event)
+}
+
+// Summary is the result of a run, it is emitted as the last event.
+type Summary struct {
+	Pipeline   int          `json:"pipeline,omitempty"`
+	Policy     string       `json:"policy"`
+	Success    bool         `json:"success"`
+	Duration   float64      `json:"duration_seconds"`
+	Jobs       []*JobResult `json:"jobs"`
+	Downloaded int          `json:"downloaded"`
+	Failed     int          `json:"failed"`
+	Error      string       `json:"error,omitempty"`
+}
+
+type JobResult struct {
+	JobEvent
+	// Set for the jobs marked optional and the failed ones allowed to fail.
+	Optional bool           `json:"optional,omitempty"`
+	Artifact *ArtifactEvent `json:"artifact,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// Report collects the results of the jobs of a run and judges them by the
+// policy, see App.Summarize.
+type Report struct {
+	mu       sync.Mutex
+	started  time.Time
+	policy   Policy
+	optional []string
+	summary  Summary
+	errs     []error
+	// Errors of the jobs which are neither optional nor allowed to fail.
+	requiredErrs []error
+}
+
+func NewReport(policy Policy, optional []string) *Report {
+	return &Report{
+		started:  time.Now(),
+		policy:   policy,
+		optional: optional,
+		summary:  Summary{Policy: policy.String(), Jobs: make([]*JobResult, 0)},
+	}
+}
+
+func (r *Report) SetPipeline(id int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.summary.Pipeline = id
+}
+
+// AddJob records the outcome of a job, the file is nil unless its artifact
+// was downloaded.
+func (r *Report) AddJob(job *gitlab.JobInfo, file *gitlab.ArtifactFile, err error) {
+	result := &JobResult{JobEvent: *newJobEvent(job), Artifact: newArtifactEvent(file)}
+	for _, name := range r.optional {
+		result.Optional = result.Optional || name == job.Name
+	}
+	if job.AllowFailure && errors.Is(err, gitlab.ErrJobFailed) {
+		result.Optional = true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		result.Error = err.Error()
+		r.summary.Failed++
+		r.errs = append(r.errs, err)
+		if !result.Optional {
+			r.requiredErrs = append(r.requiredErrs, err)
+		}
+	} else {
+		r.summary.Downloaded++
+	}
+	r.summary.Jobs = append(r.summary.Jobs, result)
+}
+
+// Finish completes the summary, err is the error the run stopped with.
+func (r *Report) Finish(err error) *Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.summary.Duration = time.Since(r.started).Seconds()
+	if err != nil {
+		r.summary.Error = err.Error()
+	}
+	r.summary.Success = err == nil && r.satisfied()
+	summary := r.summary
+	return &summary
+}
+
+func (r *Report) satisfied() bool {
+	return r.policy.Satisfied(r.summary.Downloaded, len(r.requiredErrs))
+}
+
+// Err returns nil when the policy is satisfied, otherwise the errors of the
+// jobs it counts.
+func (r *Report) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.satisfied() {
+		return nil
+	}
+	errs := r.errs
+	if r.policy.Kind == PolicyAll {
+		errs = r.requiredErrs
+	}
+	return errors.Join(append([]error{fmt.Errorf("%w: %s", errPolicyNotMet, r.policy)}, errs...)...)
+}
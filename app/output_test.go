@@ -0,0 +1,58 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
+)
+
+// downloadEvents are the events of a job whose artifact is downloaded.
+func downloadEvents() []*Event {
+	job := &gitlab.JobInfo{ID: 1, Name: "build", Status: gitlab.Success}
+	return []*Event{
+		{Type: EventJobFound, Job: newJobEvent(job), Text: "Jobs were located."},
+		{Type: EventArtifactProgress, Job: newJobEvent(job), Progress: &ProgressEvent{Bytes: 512, TotalBytes: 2048}},
+		{Type: EventWaiting, Text: "Waiting..."},
+		{Type: EventArtifactProgress, Job: newJobEvent(job), Progress: &ProgressEvent{Bytes: 2048, TotalBytes: 2048}},
+		{Type: EventArtifactDownloaded, Job: newJobEvent(job), Artifact: &ArtifactEvent{Path: "./build.zip", Size: 2048}, Text: "Artifact build was downloaded."},
+	}
+}
+
+func TestJSONOutputLeavesProgressOut(t *testing.T) {
+	var buf bytes.Buffer
+	out := NewOutput(OutputJSON, &buf)
+	for _, event := range downloadEvents() {
+		out.Emit(event)
+	}
+	types := make([]string, 0)
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		var event Event
+		if err := decoder.Decode(&event); err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, event.Type)
+	}
+	want := []string{EventJobFound, EventWaiting, EventArtifactDownloaded}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Errorf("events %v, want %v", types, want)
+	}
+}
+
+func TestTextOutputStatusLine(t *testing.T) {
+	var buf bytes.Buffer
+	out := NewOutput(OutputText, &buf)
+	for _, event := range downloadEvents() {
+		out.Emit(event)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("lines %q, want 3", lines)
+	}
+	if status := lines[1]; !strings.HasPrefix(status, "Waiting... build downloading ") || !strings.Contains(status, "25% 512 B/2.0 KiB") {
+		t.Errorf("status line %q, want the download of build at 25%%", status)
+	}
+}
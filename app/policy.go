@@ -0,0 +1,136 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Every required job has to deliver its artifact.
+	PolicyAll = "all"
+	// A single delivered artifact is enough.
+	PolicyAny = "any"
+	// At least N artifacts have to be delivered.
+	PolicyAtLeast = "atLeast"
+)
+
+// optionalMarker follows the name of a job whose artifact is not required.
+const optionalMarker = "?"
+
+// Policy decides whether a run succeeded from the artifacts it delivered.
+// Optional jobs and failed jobs that are allowed to fail are only excluded
+// by the all policy, the others count the delivered artifacts.
+type Policy struct {
+	Kind    string
+	AtLeast int
+}
+
+func ParsePolicy(value string) (Policy, error) {
+	switch value {
+	case "", PolicyAll:
+		return Policy{Kind: PolicyAll}, nil
+	case PolicyAny:
+		return Policy{Kind: PolicyAny}, nil
+	}
+	if count, ok := strings.CutPrefix(value, PolicyAtLeast+"="); ok {
+		n, err := strconv.Atoi(count)
+		if err == nil && n > 0 {
+			return Policy{Kind: PolicyAtLeast, AtLeast: n}, nil
+		}
+	}
+	return Policy{}, fmt.Errorf("%w: %q", errInvalidPolicy, value)
+}
+
+func (p *Policy) UnmarshalText(text []byte) error {
+	policy, err := ParsePolicy(string(text))
+	if err != nil {
+		return err
+	}
+	*p = policy
+	return nil
+}
+
+func (p Policy) String() string {
+	if p.Kind == PolicyAtLeast {
+		return fmt.Sprintf("%s=%d", PolicyAtLeast, p.AtLeast)
+	}
+	return p.Kind
+}
+
+// NeedsEvery tells whether every required job has to deliver its artifact.
+func (p Policy) NeedsEvery() bool {
+	return p.Kind == PolicyAll
+}
+
+// Satisfied tells whether the run succeeded, requiredFailed counts the
+// required jobs whose artifacts were not delivered.
+func (p Policy) Satisfied(delivered, requiredFailed int) bool {
+	switch p.Kind {
+	case PolicyAny:
+		return delivered >= 1
+	case PolicyAtLeast:
+		return delivered >= p.AtLeast
+	default:
+		return requiredFailed == 0
+	}
+}
+
+// splitOptionalJobs strips the optional markers from the job names.
+func splitOptionalJobs(jobs []string) ([]string, []string) {
+	names := make([]string, 0, len(jobs))
+	optional := make([]string, 0)
+	for _, job := range jobs {
+		if name, ok := strings.CutSuffix(job, optionalMarker); ok {
+			optional = append(optional, name)
+			job = name
+		}
+		names = append(names, job)
+	}
+	return names, optional
+}
+
+// RequiredJobs returns the jobs which are not marked optional.
+func (cfg *Config) RequiredJobs() []string {
+	required := make([]string, 0, len(cfg.Jobs))
+	for _, job := range cfg.Jobs {
+		if !cfg.IsOptional(job) {
+			required = append(required, job)
+		}
+	}
+	return required
+}
+
+// PreflightJobs returns the jobs the pipeline is checked for and how many of
+// them it has to create for the policy to be met, all of them when 0.
+func (cfg *Config) PreflightJobs() ([]string, int) {
+	switch cfg.Policy.Kind {
+	case PolicyAny:
+		return cfg.Jobs, 1
+	case PolicyAtLeast:
+		return cfg.Jobs, cfg.Policy.AtLeast
+	}
+	return cfg.RequiredJobs(), 0
+}
+
+// IsOptional tells whether the job is marked optional.
+func (cfg *Config) IsOptional(job string) bool {
+	for _, name := range cfg.OptionalJobs {
+		if name == job {
+			return true
+		}
+	}
+	return false
+}
+
+// markedJobs returns the jobs with the optional markers, as they are given.
+func (cfg *Config) markedJobs() []string {
+	jobs := make([]string, 0, len(cfg.Jobs))
+	for _, job := range cfg.Jobs {
+		if cfg.IsOptional(job) {
+			job += optionalMarker
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs
+}
@@ -0,0 +1,32 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPreflightJobs(t *testing.T) {
+	tests := []struct {
+		policy  string
+		jobs    []string
+		atLeast int
+	}{
+		{"all", []string{"build"}, 0},
+		{"any", []string{"build", "reports"}, 1},
+		{"atLeast=2", []string{"build", "reports"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			policy, err := ParsePolicy(tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := &Config{Policy: policy}
+			cfg.Jobs, cfg.OptionalJobs = splitOptionalJobs([]string{"build", "reports?"})
+			jobs, atLeast := cfg.PreflightJobs()
+			if !reflect.DeepEqual(jobs, tt.jobs) || atLeast != tt.atLeast {
+				t.Errorf("PreflightJobs() = %v, %d, want %v, %d", jobs, atLeast, tt.jobs, tt.atLeast)
+			}
+		})
+	}
+}
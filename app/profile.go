@@ -0,0 +1,188 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultConfigDir  = "gitlab-artifacts-downloader"
+	defaultConfigFile = "config.yml"
+	defaultProfile    = "default"
+)
+
+// Profile is a named set of settings kept in the configuration file.
+type Profile struct {
+	URL           string                 `yaml:"url,omitempty"`
+	Auth          string                 `yaml:"auth,omitempty"`
+	Token         string                 `yaml:"token,omitempty"`
+	TokenEnv      string                 `yaml:"token_env,omitempty"`
+	TokenFile     string                 `yaml:"token_file,omitempty"`
+	TokenHelper   string                 `yaml:"token_helper,omitempty"`
+	TokenKeyring  bool                   `yaml:"token_keyring,omitempty"`
+	OAuthClientID string                 `yaml:"oauth_client_id,omitempty"`
+	TriggerToken  string                 `yaml:"trigger_token,omitempty"`
+	Project       string                 `yaml:"project,omitempty"`
+	Branch        string                 `yaml:"branch,omitempty"`
+	Jobs          []string               `yaml:"jobs,omitempty"`
+	Policy        string                 `yaml:"policy,omitempty"`
+	Folder        string                 `yaml:"folder,omitempty"`
+	Variables     map[string]string      `yaml:"variables,omitempty"`
+	Inputs        map[string]interface{} `yaml:"inputs,omitempty"`
+	Timeout       string                 `yaml:"timeout,omitempty"`
+	Retries       *int                   `yaml:"retries,omitempty"`
+	RetryWaitMin  string                 `yaml:"retry_wait_min,omitempty"`
+	RetryWaitMax  string                 `yaml:"retry_wait_max,omitempty"`
+	RateLimit     float64                `yaml:"rate_limit,omitempty"`
+	RateBurst     int                    `yaml:"rate_burst,omitempty"`
+	Concurrency   int                    `yaml:"concurrency,omitempty"`
+	Bandwidth     string                 `yaml:"bandwidth_limit,omitempty"`
+	Order         string                 `yaml:"download_order,omitempty"`
+	CacheDir      string                 `yaml:"cache_dir,omitempty"`
+	CAFile        string                 `yaml:"ca_file,omitempty"`
+	ClientCert    string                 `yaml:"client_cert,omitempty"`
+	ClientKey     string                 `yaml:"client_key,omitempty"`
+	Proxy         string                 `yaml:"proxy,omitempty"`
+	UnixSocket    string                 `yaml:"unix_socket,omitempty"`
+	Insecure      bool                   `yaml:"insecure_skip_verify,omitempty"`
+}
+
+type configFile struct {
+	DefaultProfile string              `yaml:"default_profile"`
+	Profiles       map[string]*Profile `yaml:"profiles"`
+}
+
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, defaultConfigDir, defaultConfigFile)
+}
+
+// loadProfile reads the named profile from the configuration file. When
+// neither the file nor the profile were asked for explicitly, a missing
+// default file or profile is not an error.
+func loadProfile(path, name string) (*Profile, string, string, error) {
+	explicit := path != "" || name != ""
+	if path == "" {
+		path = defaultConfigPath()
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !explicit {
+			return nil, "", "", nil
+		}
+		return nil, "", "", err
+	}
+
+	var file configFile
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, "", "", fmt.Errorf("%w %s: %w", errInvalidConfigFile, path, err)
+	}
+
+	if name == "" {
+		name = file.DefaultProfile
+	}
+	if name == "" {
+		name = defaultProfile
+	}
+	profile, ok := file.Profiles[name]
+	if !ok {
+		if !explicit && file.DefaultProfile == "" {
+			return nil, "", "", nil
+		}
+		return nil, "", "", fmt.Errorf("%w: %q in %s", errUnknownProfile, name, path)
+	}
+	return profile, name, path, nil
+}
+
+// apply copies the profile settings onto the configuration.
+func (p *Profile) apply(cfg *Config, name string, environment map[string]string) error {
+	cfg.BaseURL = p.URL
+	cfg.Auth = gitlab.AuthMode(p.Auth)
+	cfg.Token = p.Token
+	if p.Token != "" {
+		cfg.TokenSource = "profile " + name
+	}
+	if p.TokenEnv != "" && !tokenSourceSelected(environment) {
+		if environment[p.TokenEnv] == "" {
+			return fmt.Errorf("%w: %s of profile %s", errTokenEnvUnset, p.TokenEnv, name)
+		}
+		cfg.Token = environment[p.TokenEnv]
+		cfg.TokenSource = "env " + p.TokenEnv
+	}
+	cfg.TokenFile = p.TokenFile
+	cfg.TokenHelper = p.TokenHelper
+	cfg.TokenKeyring = p.TokenKeyring
+	cfg.OAuthClientID = p.OAuthClientID
+	cfg.TriggerToken = p.TriggerToken
+	cfg.Project = p.Project
+	cfg.Branch = p.Branch
+	cfg.Jobs = p.Jobs
+	if p.Policy != "" {
+		policy, err := ParsePolicy(p.Policy)
+		if err != nil {
+			return err
+		}
+		cfg.Policy = policy
+	}
+	cfg.Folder = p.Folder
+	cfg.KeyValues = p.Variables
+	cfg.Inputs = p.Inputs
+	if p.Timeout != "" {
+		timeout, err := parseTimeout(p.Timeout)
+		if err != nil {
+			return err
+		}
+		cfg.Timeout = timeout
+	}
+	if p.Retries != nil {
+		cfg.Retries = *p.Retries
+	}
+	for _, wait := range []struct {
+		value string
+		to    *time.Duration
+	}{{p.RetryWaitMin, &cfg.RetryWaitMin}, {p.RetryWaitMax, &cfg.RetryWaitMax}} {
+		if wait.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(wait.value)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errInvalidRetries, err)
+		}
+		*wait.to = d
+	}
+	cfg.RateLimit = p.RateLimit
+	cfg.RateBurst = p.RateBurst
+	cfg.Concurrency = p.Concurrency
+	if p.Bandwidth != "" {
+		bandwidth, err := ParseBandwidth(p.Bandwidth)
+		if err != nil {
+			return err
+		}
+		cfg.BandwidthLimit = bandwidth
+	}
+	if p.Order != "" {
+		order, err := ParseDownloadOrder(p.Order)
+		if err != nil {
+			return err
+		}
+		cfg.DownloadOrder = order
+	}
+	cfg.CacheDir = p.CacheDir
+	cfg.CAFile = p.CAFile
+	cfg.ClientCert = p.ClientCert
+	cfg.ClientKey = p.ClientKey
+	cfg.Proxy = p.Proxy
+	cfg.UnixSocket = p.UnixSocket
+	cfg.InsecureSkipVerify = p.Insecure
+	return nil
+}
@@ -0,0 +1,338 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
+)
+
+const (
+	// How often the terminal view is redrawn.
+	redrawInterval = 500 * time.Millisecond
+	// Width of the terminal when COLUMNS does not tell.
+	defaultWidth = 80
+	// Cells of a progress bar.
+	barWidth = 12
+)
+
+// States of a job after its artifact is ready.
+const (
+	stateDownloading = "downloading"
+	stateDownloaded  = "downloaded"
+	stateFailed      = "failed"
+)
+
+// progress follows the jobs of a run and their downloads from the events,
+// for the status of the text output.
+type progress struct {
+	jobs  []*jobProgress
+	names map[string]*jobProgress
+}
+
+type jobProgress struct {
+	name string
+	// GitLab status, until the state takes over.
+	status string
+	state  string
+	found  time.Time
+	// Set once the job is done with, its elapsed time stops.
+	ended time.Time
+
+	downloadStarted time.Time
+	read, total     int64
+}
+
+func newProgress() *progress {
+	return &progress{names: make(map[string]*jobProgress)}
+}
+
+func (p *progress) update(event *Event, now time.Time) {
+	if event.Job == nil {
+		return
+	}
+	if event.Type == EventJobFound {
+		if _, ok := p.names[event.Job.Name]; !ok {
+			job := &jobProgress{name: event.Job.Name, status: event.Job.Status, found: now}
+			p.jobs = append(p.jobs, job)
+			p.names[job.name] = job
+		}
+		return
+	}
+	// Jobs which are not waited for, e.g. the canceled ones, are left out.
+	job, ok := p.names[event.Job.Name]
+	if !ok {
+		return
+	}
+	switch event.Type {
+	case EventJobStatus:
+		job.status = event.Job.Status
+	case EventJobRetried:
+		job.status, job.state, job.ended = event.Job.Status, "", time.Time{}
+	case EventJobCanceled:
+		if event.Error == "" {
+			job.status, job.ended = gitlab.Canceled, now
+		}
+	case EventArtifactProgress:
+		if job.state != stateDownloading {
+			job.state, job.downloadStarted = stateDownloading, now
+		}
+		job.read, job.total = event.Progress.Bytes, event.Progress.TotalBytes
+	case EventArtifactDownloaded:
+		job.state, job.ended = stateDownloaded, now
+		if event.Artifact != nil {
+			job.read, job.total = event.Artifact.Size, event.Artifact.Size
+		}
+	case EventError:
+		job.state, job.ended = stateFailed, now
+	}
+}
+
+func (j *jobProgress) done() bool {
+	return !j.ended.IsZero()
+}
+
+func (j *jobProgress) elapsed(now time.Time) time.Duration {
+	if j.done() {
+		now = j.ended
+	}
+	return now.Sub(j.found).Round(time.Second)
+}
+
+// label is the status of the job, or the state of its artifact.
+func (j *jobProgress) label() string {
+	switch {
+	case j.state != "":
+		return j.state
+	case j.status == gitlab.Success:
+		return "queued"
+	}
+	return j.status
+}
+
+// transfer tells the bytes read so far and the throughput of the download.
+func (j *jobProgress) transfer(now time.Time) string {
+	if j.done() {
+		now = j.ended
+	}
+	size := formatBytes(j.read)
+	if j.total > 0 && j.state == stateDownloading {
+		size = fmt.Sprintf("%d%% %s/%s", j.percent(), formatBytes(j.read), formatBytes(j.total))
+	}
+	seconds := now.Sub(j.downloadStarted).Seconds()
+	if j.downloadStarted.IsZero() || seconds <= 0 {
+		return size
+	}
+	return fmt.Sprintf("%s %s/s", size, formatBytes(int64(float64(j.read)/seconds)))
+}
+
+func (j *jobProgress) percent() int64 {
+	if j.total <= 0 {
+		return 0
+	}
+	if j.read >= j.total {
+		return 100
+	}
+	return j.read * 100 / j.total
+}
+
+func (j *jobProgress) bar() string {
+	if j.total <= 0 {
+		return ""
+	}
+	filled := int(j.percent()) * barWidth / 100
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", barWidth-filled) + "]"
+}
+
+// lines renders a line per job for the terminal view, cut to the width.
+func (p *progress) lines(now time.Time, width int) []string {
+	nameWidth := 0
+	for _, job := range p.jobs {
+		if n := utf8.RuneCountInString(job.name); n > nameWidth {
+			nameWidth = n
+		}
+	}
+	lines := make([]string, 0, len(p.jobs))
+	for _, job := range p.jobs {
+		line := fmt.Sprintf("%-*s  %-11s %7s", nameWidth, job.name, job.label(), job.elapsed(now))
+		switch job.state {
+		case stateDownloading:
+			line += "  " + strings.TrimSpace(job.bar()+" "+job.transfer(now))
+		case stateDownloaded:
+			line += "  " + job.transfer(now)
+		}
+		if runes := []rune(line); len(runes) >= width {
+			line = string(runes[:width-1])
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// status is a single line about the jobs which are not done with yet.
+func (p *progress) status(now time.Time) string {
+	parts := make([]string, 0, len(p.jobs))
+	for _, job := range p.jobs {
+		if job.done() {
+			continue
+		}
+		part := fmt.Sprintf("%s %s %s", job.name, job.label(), job.elapsed(now))
+		if job.state == stateDownloading {
+			part += " " + job.transfer(now)
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return "Waiting..."
+	}
+	return "Waiting... " + strings.Join(parts, ", ")
+}
+
+// formatBytes uses binary units, e.g. 4.5 MiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// liveOutput shows the text lines with a view of the jobs under them, which
+// is redrawn in place on a terminal until the summary.
+type liveOutput struct {
+	mu       sync.Mutex
+	w        io.Writer
+	width    int
+	progress *progress
+	// Lines of the view on the screen.
+	drawn    int
+	ticking  bool
+	finished bool
+	stop     chan struct{}
+}
+
+func newLiveOutput(w io.Writer) *liveOutput {
+	width, err := strconv.Atoi(os.Getenv("COLUMNS"))
+	if err != nil || width <= 1 {
+		width = defaultWidth
+	}
+	return &liveOutput{w: w, width: width, progress: newProgress(), stop: make(chan struct{})}
+}
+
+func (o *liveOutput) Emit(event *Event) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := time.Now()
+	o.progress.update(event, now)
+	text := event.Text
+	if event.Type == EventWaiting {
+		// The view tells more than the waiting line.
+		text = ""
+	}
+	if o.finished {
+		if text != "" {
+			fmt.Fprintln(o.w, text)
+		}
+		return
+	}
+	if !o.ticking && len(o.progress.jobs) != 0 {
+		o.ticking = true
+		go o.tick()
+	}
+	if text == "" && event.Type != EventSummary {
+		// The view catches up at the next tick.
+		return
+	}
+
+	o.clear()
+	if event.Type == EventSummary {
+		// The last state of the jobs stays above the summary.
+		o.draw(now)
+		o.drawn, o.finished = 0, true
+		if o.ticking {
+			close(o.stop)
+		}
+	}
+	if text != "" {
+		fmt.Fprintln(o.w, text)
+	}
+	if !o.finished {
+		o.draw(now)
+	}
+}
+
+// tick redraws the view, for the elapsed times, until the summary.
+func (o *liveOutput) tick() {
+	ticker := time.NewTicker(redrawInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-o.stop:
+			return
+		case now := <-ticker.C:
+			o.mu.Lock()
+			if !o.finished {
+				o.clear()
+				o.draw(now)
+			}
+			o.mu.Unlock()
+		}
+	}
+}
+
+// clear erases the view, the cursor is left where it started.
+func (o *liveOutput) clear() {
+	if o.drawn != 0 {
+		fmt.Fprintf(o.w, "\x1b[%dA\r\x1b[J", o.drawn)
+		o.drawn = 0
+	}
+}
+
+func (o *liveOutput) draw(now time.Time) {
+	lines := o.progress.lines(now, o.width)
+	for _, line := range lines {
+		fmt.Fprintln(o.w, line)
+	}
+	o.drawn = len(lines)
+}
+
+// liveLogWriter writes the log lines of a live output, the view is cleared
+// before a line and drawn again after it. The logs go to stderr, often the
+// same terminal, where they would be overwritten by the view.
+type liveLogWriter struct {
+	live *liveOutput
+	w    io.Writer
+}
+
+func (l *liveLogWriter) Write(p []byte) (int, error) {
+	o := l.live
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.clear()
+	n, err := l.w.Write(p)
+	if !o.finished {
+		o.draw(time.Now())
+	}
+	return n, err
+}
+
+// isTerminal tells whether the writer is a terminal able to redraw lines.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
+)
+
+func TestProgressLinesFitTheWidth(t *testing.T) {
+	p := newProgress()
+	now := time.Now()
+	for _, name := range []string{"build", strings.Repeat("é", 30)} {
+		p.update(&Event{Type: EventJobFound, Job: newJobEvent(&gitlab.JobInfo{Name: name, Status: gitlab.Running})}, now)
+	}
+	for _, line := range p.lines(now, 40) {
+		if !utf8.ValidString(line) {
+			t.Errorf("line %q was cut in the middle of a character", line)
+		}
+		if n := utf8.RuneCountInString(line); n >= 40 {
+			t.Errorf("line %q is %d characters wide, want less than 40", line, n)
+		}
+	}
+}
+
+func TestLogWriterKeepsTheViewClear(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	live := newLiveOutput(&stdout)
+	job := &gitlab.JobInfo{Name: "build", Status: gitlab.Running}
+	live.Emit(&Event{Type: EventJobFound, Job: newJobEvent(job), Text: "Jobs were located."})
+	defer live.Emit(&Event{Type: EventSummary})
+
+	// The view is also redrawn by its ticker.
+	live.mu.Lock()
+	drawn := stdout.Len()
+	live.mu.Unlock()
+	log := LogWriter(live, &stderr)
+	if _, err := log.Write([]byte("level=DEBUG msg=request\n")); err != nil {
+		t.Fatal(err)
+	}
+	if stderr.String() != "level=DEBUG msg=request\n" {
+		t.Errorf("stderr %q, want the log line", stderr.String())
+	}
+	// The view of the job is erased before the line and drawn under it.
+	live.mu.Lock()
+	redrawn := stdout.String()[drawn:]
+	live.mu.Unlock()
+	if !strings.HasPrefix(redrawn, "\x1b[1A\r\x1b[J") || !strings.Contains(redrawn, "build") {
+		t.Errorf("stdout after the log line %q, want the view cleared and drawn again", redrawn)
+	}
+
+	if w := LogWriter(NewOutput(OutputJSON, &stdout), &stderr); w != &stderr {
+		t.Error("logs along with the JSON output are not written as they are")
+	}
+}
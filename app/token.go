@@ -0,0 +1,190 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
+	"gopkg.in/yaml.v3"
+)
+
+const keyringService = "gitlab-artifacts-downloader"
+
+// tokenSourceSelected tells whether the env variables choose where the token
+// comes from, e.g. GAD_TOKEN_KEYRING=false does not.
+func tokenSourceSelected(environment map[string]string) bool {
+	for _, name := range []string{"GAD_TOKEN", "GAD_TOKEN_FILE", "GAD_TOKEN_HELPER"} {
+		if environment[name] != "" {
+			return true
+		}
+	}
+	keyring, _ := strconv.ParseBool(environment["GAD_TOKEN_KEYRING"])
+	return keyring
+}
+
+// resolveToken finds the API token when it is not given as a value. The
+// sources are tried in order: the ones asked for explicitly, GAD_TOKEN_FILE,
+// the credential helper and the Secret Service keyring, then the glab CLI
+// config, the token stored by the login command and CI_JOB_TOKEN of a CI job.
+func resolveToken(cfg *Config, environment map[string]string) error {
+	if cfg.Token != "" {
+		return nil
+	}
+
+	host := ""
+	if u, err := url.Parse(cfg.BaseURL); err == nil {
+		host = u.Host
+	}
+
+	if cfg.TokenFile != "" {
+		content, err := os.ReadFile(cfg.TokenFile)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errTokenSource, err)
+		}
+		cfg.Token = strings.TrimSpace(string(content))
+		cfg.TokenSource = "file " + cfg.TokenFile
+		return nil
+	}
+
+	if cfg.TokenHelper != "" {
+		token, err := credentialHelperToken(cfg.TokenHelper, cfg.BaseURL)
+		if err != nil {
+			return fmt.Errorf("%w: credential helper: %w", errTokenSource, err)
+		}
+		cfg.Token, cfg.TokenSource = token, "credential helper"
+		return nil
+	}
+
+	if cfg.TokenKeyring {
+		token, err := keyringToken(host)
+		if err != nil {
+			return fmt.Errorf("%w: keyring: %w", errTokenSource, err)
+		}
+		cfg.Token, cfg.TokenSource = token, "keyring"
+		return nil
+	}
+
+	if host != "" {
+		if token := glabToken(host, environment); token != "" {
+			cfg.Token, cfg.TokenSource = token, "glab config"
+			return nil
+		}
+	}
+
+	if host != "" && (cfg.Auth == "" || cfg.Auth == gitlab.AuthOAuth) {
+		path := credentialsPath(environment)
+		logins, err := loadLogins(path)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errTokenSource, err)
+		}
+		if login, ok := logins[host]; ok && login.Token != nil {
+			cfg.Auth = gitlab.AuthOAuth
+			cfg.Token, cfg.TokenSource = login.Token.AccessToken, "login credentials "+path
+			cfg.login, cfg.loginPath = login, path
+			return nil
+		}
+	}
+
+	if isInsideCI(environment) && cfg.TriggerToken == "" && (cfg.Auth == "" || cfg.Auth == gitlab.AuthJobToken) {
+		cfg.Auth = gitlab.AuthJobToken
+		cfg.Token, cfg.TokenSource = environment["CI_JOB_TOKEN"], "env CI_JOB_TOKEN"
+	}
+	return nil
+}
+
+// credentialHelperToken asks a git credential helper for the password of the
+// GitLab URL. The helper is written the way git's credential.helper is: a
+// helper name, a command with arguments or a shell snippet starting with `!`.
+func credentialHelperToken(helper, baseURL string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	var cmd *exec.Cmd
+	switch {
+	case strings.HasPrefix(helper, "!"):
+		cmd = exec.Command("sh", "-c", helper[1:]+" get")
+	case !strings.ContainsAny(helper, " /"):
+		cmd = exec.Command("git", "credential-"+helper, "get")
+	default:
+		args := strings.Fields(helper)
+		cmd = exec.Command(args[0], append(args[1:], "get")...)
+	}
+
+	var request bytes.Buffer
+	fmt.Fprintf(&request, "protocol=%s\nhost=%s\n", u.Scheme, u.Host)
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		fmt.Fprintf(&request, "path=%s\n", path)
+	}
+	request.WriteString("\n")
+	var stderr bytes.Buffer
+	cmd.Stdin = &request
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		// The helper tells on stderr why it failed, e.g. a locked store.
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if key, value, ok := strings.Cut(scanner.Text(), "="); ok && key == "password" && value != "" {
+			return value, nil
+		}
+	}
+	return "", errors.New("no password returned")
+}
+
+type glabConfig struct {
+	Hosts map[string]struct {
+		Token string `yaml:"token"`
+	} `yaml:"hosts"`
+}
+
+// glabToken reads the token of the host from the glab CLI config, if any.
+func glabToken(host string, environment map[string]string) string {
+	dir := environment["GLAB_CONFIG_DIR"]
+	if dir == "" {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(configDir, "glab-cli")
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "config.yml"))
+	if err != nil {
+		return ""
+	}
+	var config glabConfig
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return ""
+	}
+	return config.Hosts[host].Token
+}
+
+// keyringToken looks the token up in the Secret Service keyring with
+// secret-tool. It is stored with
+// `secret-tool store --label=GitLab service gitlab-artifacts-downloader host <host>`.
+func keyringToken(host string) (string, error) {
+	output, err := exec.Command("secret-tool", "lookup", "service", keyringService, "host", host).Output()
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(output))
+	if token == "" {
+		return "", errors.New("no token stored for " + host)
+	}
+	return token, nil
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSources writes a glab config and a secret-tool returning another token.
+func fakeSources(t *testing.T) map[string]string {
+	t.Helper()
+	glabDir := t.TempDir()
+	glab := "hosts:\n  gitlab.example.com:\n    token: glab-token\n"
+	if err := os.WriteFile(filepath.Join(glabDir, "config.yml"), []byte(glab), 0600); err != nil {
+		t.Fatal(err)
+	}
+	binDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(binDir, "secret-tool"), []byte("#!/bin/sh\necho keyring-token\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir)
+	return map[string]string{"GLAB_CONFIG_DIR": glabDir}
+}
+
+func TestResolveTokenPrefersExplicitSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyring bool
+		token   string
+		source  string
+	}{
+		{"keyring asked for", true, "keyring-token", "keyring"},
+		{"glab config", false, "glab-token", "glab config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			environment := fakeSources(t)
+			cfg := &Config{BaseURL: "https://gitlab.example.com/api/v4", TokenKeyring: tt.keyring}
+			if err := resolveToken(cfg, environment); err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Token != tt.token || cfg.TokenSource != tt.source {
+				t.Errorf("token %q from %q, want %q from %q", cfg.Token, cfg.TokenSource, tt.token, tt.source)
+			}
+		})
+	}
+}
+
+func TestResolveTokenHelperError(t *testing.T) {
+	cfg := &Config{
+		BaseURL:     "https://gitlab.example.com/api/v4",
+		TokenHelper: "!echo 'store is locked' >&2; exit 1;",
+	}
+	err := resolveToken(cfg, map[string]string{})
+	var exitErr *exec.ExitError
+	if !errors.Is(err, errTokenSource) || !errors.As(err, &exitErr) {
+		t.Fatalf("err = %v, want a token source error of the helper", err)
+	}
+	if !strings.Contains(err.Error(), "store is locked") {
+		t.Errorf("err = %v, want the helper's message", err)
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/app"
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
+)
+
+var (
+	errNoPipeline = errors.New("no pipeline given, use -pipeline or -current")
+	errNoTarget   = errors.New("either -pipeline or -job has to be given")
+	errNoAPIToken = errors.New("waiting for jobs needs a personal access or OAuth token in GAD_TOKEN")
+
+	errUnexpectedArgs = errors.New("unexpected arguments")
+	errInvalidJobID   = errors.New("invalid job ID")
+)
+
+type command struct {
+	name    string
+	summary string
+	// Settings the command needs on top of the GitLab connection ones.
+	requires []string
+	// Offline commands do not connect to GitLab.
+	offline bool
+	// setup registers the command's own flags and returns its action.
+	setup func(flags *flag.FlagSet) func(app *app.App) error
+}
+
+var commands = []*command{
+	{
+		name:     "run",
+		summary:  "Trigger a pipeline, wait for the jobs and download their artifacts. The default command.",
+		requires: []string{"GAD_BRANCH", "-j"},
+		setup: func(flags *flag.FlagSet) func(app *app.App) error {
+			return runCommand
+		},
+	},
+	{
+		name:     "trigger",
+		summary:  "Trigger a pipeline and print its ID.",
+		requires: []string{"GAD_BRANCH"},
+		setup: func(flags *flag.FlagSet) func(app *app.App) error {
+			return triggerCommand
+		},
+	},
+	{
+		name:    "wait",
+		summary: "Wait for the jobs of a pipeline to finish.",
+		setup: func(flags *flag.FlagSet) func(app *app.App) error {
+			pipelineID := flags.Int("pipeline", 0, "ID of the pipeline, the current one with -current.")
+			return func(app *app.App) error {
+				return waitCommand(app, *pipelineID)
+			}
+		},
+	},
+	{
+		name:    "jobs list",
+		summary: "List the jobs of a pipeline.",
+		setup: func(flags *flag.FlagSet) func(app *app.App) error {
+			pipelineID := flags.Int("pipeline", 0, "ID of the pipeline, the current one with -current.")
+			scope := flags.String("scope", "", "[optional] Comma separated job statuses to list.")
+			return func(app *app.App) error {
+				return listJobsCommand(app, *pipelineID, *scope)
+			}
+		},
+	},
+	{
+		name:    "download",
+		summary: "Download the artifacts of jobs given by IDs or by -j names of a pipeline.",
+		setup: func(flags *flag.FlagSet) func(app *app.App) error {
+			pipelineID := flags.Int("pipeline", 0, "ID of the pipeline the -j jobs belong to.")
+			jobIDs := flags.String("job", "", "Comma separated IDs of the jobs.")
+			return func(app *app.App) error {
+				return downloadCommand(app, *pipelineID, *jobIDs)
+			}
+		},
+	},
+	{
+		name:    "cancel",
+		summary: "Cancel a pipeline or jobs.",
+		setup: func(flags *flag.FlagSet) func(app *app.App) error {
+			pipelineID := flags.Int("pipeline", 0, "ID of the pipeline to cancel.")
+			jobIDs := flags.String("job", "", "Comma separated IDs of the jobs to cancel.")
+			return func(app *app.App) error {
+				return cancelCommand(app, *pipelineID, *jobIDs)
+			}
+		},
+	},
+	{
+		name:    "retry",
+		summary: "Retry the failed jobs of a pipeline or the given jobs.",
+		setup: func(flags *flag.FlagSet) func(app *app.App) error {
+			pipelineID := flags.Int("pipeline", 0, "ID of the pipeline to retry.")
+			jobIDs := flags.String("job", "", "Comma separated IDs of the jobs to retry.")
+			return func(app *app.App) error {
+				return retryCommand(app, *pipelineID, *jobIDs)
+			}
+		},
+	},
+	{
+		name:    "config show",
+		summary: "Print the effective configuration with the secrets masked.",
+		offline: true,
+		setup: func(flags *flag.FlagSet) func(app *app.App) error {
+			return func(app *app.App) error {
+				if err := app.Config.Show(os.Stdout); err != nil {
+					return fail("printing the configuration", err)
+				}
+				return nil
+			}
+		},
+	},
+	{
+		name:    "login",
+		summary: "Log in to GitLab with the OAuth2 device authorization flow.",
+		offline: true,
+		setup: func(flags *flag.FlagSet) func(app *app.App) error {
+			return func(a *app.App) error {
+				if a.Config.InsecureSkipVerify {
+					a.Log.Warn(gitlab.InsecureSkipVerifyWarning)
+				}
+				if err := app.Login(a.Ctx, a.Config, os.Stdout); err != nil {
+					return fail("logging in", err)
+				}
+				return nil
+			}
+		},
+	},
+}
+
+// findCommand matches the leading arguments against the command names and
+// returns the remaining arguments. Without a match the default command runs.
+func findCommand(args []string) (*command, []string) {
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(args) < len(words) {
+			continue
+		}
+		if strings.Join(args[:len(words)], " ") == cmd.name {
+			return cmd, args[len(words):]
+		}
+	}
+	return commands[0], args
+}
+
+func printUsage() {
+	fmt.Println("Dowloader of gitlab-ci artifacts.")
+	fmt.Println()
+	fmt.Println("Usage: ci-downloader [command] [flags]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	w.Flush()
+	fmt.Println()
+	fmt.Println("Run `ci-downloader <command> -h` for the flags of a command.")
+}
+
+// pipelineFor returns the pipeline given by the flag or the current one.
+func pipelineFor(app *app.App, pipelineID int) (*gitlab.PipelineInfo, error) {
+	if pipelineID == 0 {
+		pipelineID = app.Config.PipelineID
+	}
+	if pipelineID == 0 {
+		return nil, errNoPipeline
+	}
+	pipeline := newPipeline(app)
+	pipeline.ID = &pipelineID
+	return pipeline, nil
+}
+
+func parseJobIDs(jobIDs string) ([]int, error) {
+	ids := make([]int, 0)
+	for _, field := range strings.Split(jobIDs, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		id, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", errInvalidJobID, field)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// jobsByIDs fetches the jobs given by comma separated IDs.
+func jobsByIDs(app *app.App, jobIDs string) (*gitlab.PipelineInfo, []*gitlab.JobInfo, error) {
+	ids, err := parseJobIDs(jobIDs)
+	if err != nil {
+		return nil, nil, failWith(exitConfig, "parsing the job IDs", err)
+	}
+	pipeline := newPipeline(app)
+	jobs := make([]*gitlab.JobInfo, 0, len(ids))
+	for _, id := range ids {
+		job, err := app.GitlabCli.GetJob(pipeline, id)
+		if err != nil {
+			return nil, nil, fail(fmt.Sprintf("getting the job %d", id), err)
+		}
+		jobs = append(jobs, job)
+	}
+	return pipeline, jobs, nil
+}
+
+// artifactJobsByIDs is jobsByIDs for downloads. A job token can download
+// artifacts but cannot read the jobs, their artifacts are named after the
+// job IDs then.
+func artifactJobsByIDs(app *app.App, jobIDs string) (*gitlab.PipelineInfo, []*gitlab.JobInfo, error) {
+	if app.GitlabCli.CanWaitJobs() == nil {
+		return jobsByIDs(app, jobIDs)
+	}
+	ids, err := parseJobIDs(jobIDs)
+	if err != nil {
+		return nil, nil, failWith(exitConfig, "parsing the job IDs", err)
+	}
+	jobs := make([]*gitlab.JobInfo, 0, len(ids))
+	for _, id := range ids {
+		jobs = append(jobs, &gitlab.JobInfo{ID: id, Name: "job-" + strconv.Itoa(id)})
+	}
+	return newPipeline(app), jobs, nil
+}
+
+// findPipelineJobs returns the -j jobs of the pipeline, or all of them.
+func findPipelineJobs(app *app.App, pipeline *gitlab.PipelineInfo) ([]*gitlab.JobInfo, error) {
+	jobsSearch := &gitlab.JobsSearch{}
+	if len(app.Config.Jobs) != 0 {
+		jobsSearch.Jobs = &app.Config.Jobs
+	}
+	jobs, err := app.GitlabCli.FindJobs(app.Ctx, pipeline, jobsSearch, nil)
+	if err != nil {
+		return nil, fail("getting jobs", err)
+	}
+	return jobs, nil
+}
+
+func triggerCommand(app *app.App) error {
+	pipeline := newPipeline(app)
+	if err := prepareInputs(app, pipeline); err != nil {
+		return err
+	}
+	// Only the ID goes to stdout, so that scripts can capture it.
+	if err := triggerPipeline(app, pipeline); err != nil {
+		return err
+	}
+	if app.Config.JSONOutput() {
+		app.PipelineCreated(*pipeline.ID)
+	} else {
+		fmt.Println(*pipeline.ID)
+	}
+	return nil
+}
+
+func waitCommand(app *app.App, pipelineID int) error {
+	pipeline, err := pipelineFor(app, pipelineID)
+	if err != nil {
+		return failWith(exitConfig, "waiting for the pipeline", err)
+	}
+	jobs, err := findPipelineJobs(app, pipeline)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(app.Ctx, app.Config.Timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(jobs))
+	// Every failure is reported, in the order of the jobs.
+	for i, job := range jobs {
+		wg.Add(1)
+		go func(i int, job *gitlab.JobInfo) {
+			defer wg.Done()
+			if err := app.GitlabCli.WaitJob(ctx, pipeline, job); err != nil {
+				app.Error(job, err, fmt.Sprintf("Job %s: %s", job.Name, err.Error()))
+				errs[i] = err
+				return
+			}
+			app.JobFinished(job)
+		}(i, job)
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return fail("waiting for jobs", err)
+	}
+	return nil
+}
+
+func listJobsCommand(app *app.App, pipelineID int, scope string) error {
+	pipeline, err := pipelineFor(app, pipelineID)
+	if err != nil {
+		return failWith(exitConfig, "listing jobs", err)
+	}
+	jobsSearch := &gitlab.JobsSearch{}
+	if scope != "" {
+		states := strings.Split(scope, ",")
+		jobsSearch.States = &states
+	}
+	jobs, err := app.GitlabCli.FindJobs(app.Ctx, pipeline, jobsSearch, nil)
+	if err != nil {
+		return fail("listing jobs", err)
+	}
+	if app.Config.JSONOutput() {
+		app.JobsFound(jobs)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSTAGE\tSTATUS")
+	for _, job := range jobs {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", job.ID, job.Name, job.Stage, job.Status)
+	}
+	return w.Flush()
+}
+
+func downloadCommand(app *app.App, pipelineID int, jobIDs string) error {
+	var (
+		pipeline *gitlab.PipelineInfo
+		jobs     []*gitlab.JobInfo
+		err      error
+	)
+	if jobIDs != "" {
+		pipeline, jobs, err = artifactJobsByIDs(app, jobIDs)
+	} else {
+		if len(app.Config.Jobs) == 0 {
+			return failWith(exitConfig, "downloading artifacts", errNoTarget)
+		}
+		if pipeline, err = pipelineFor(app, pipelineID); err != nil {
+			return failWith(exitConfig, "downloading artifacts", err)
+		}
+		jobs, err = findPipelineJobs(app, pipeline)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The artifacts go through the workers as for run, every failure is
+	// reported.
+	queue := newDownloadQueue(app.Config.DownloadFirst)
+	for _, job := range jobs {
+		queue.Push(&download{job: job})
+	}
+	queue.Close()
+	if err := <-startDownloads(app, pipeline, queue); err != nil {
+		return failWith(exitDownload, "downloading artifacts", err)
+	}
+	return nil
+}
+
+func cancelCommand(app *app.App, pipelineID int, jobIDs string) error {
+	if jobIDs != "" {
+		pipeline, jobs, err := jobsByIDs(app, jobIDs)
+		if err != nil {
+			return err
+		}
+		for _, job := range jobs {
+			if err := app.GitlabCli.CancelJob(pipeline, job); err != nil {
+				return fail(fmt.Sprintf("canceling the job %s", job.Name), err)
+			}
+			app.JobCanceled(job, nil)
+		}
+		return nil
+	}
+
+	pipeline, err := pipelineFor(app, pipelineID)
+	if err != nil {
+		return failWith(exitConfig, "canceling", errNoTarget)
+	}
+	if err := app.GitlabCli.CancelPipeline(pipeline); err != nil {
+		return fail("canceling the pipeline", err)
+	}
+	app.PipelineCanceled(*pipeline.ID)
+	return nil
+}
+
+func retryCommand(app *app.App, pipelineID int, jobIDs string) error {
+	if jobIDs != "" {
+		pipeline, jobs, err := jobsByIDs(app, jobIDs)
+		if err != nil {
+			return err
+		}
+		for _, job := range jobs {
+			retried, err := app.GitlabCli.RetryJob(pipeline, job)
+			if err != nil {
+				return fail(fmt.Sprintf("retrying the job %s", job.Name), err)
+			}
+			app.JobRetried(job, retried)
+		}
+		return nil
+	}
+
+	pipeline, err := pipelineFor(app, pipelineID)
+	if err != nil {
+		return failWith(exitConfig, "retrying", errNoTarget)
+	}
+	if err := app.GitlabCli.RetryPipeline(pipeline); err != nil {
+		return fail("retrying the pipeline", err)
+	}
+	app.PipelineRetried(*pipeline.ID)
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/app"
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
+)
+
+func TestParseJobIDs(t *testing.T) {
+	ids, err := parseJobIDs(" 12, 7,,30 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || ids[0] != 12 || ids[1] != 7 || ids[2] != 30 {
+		t.Errorf("ids = %v, want 12, 7 and 30", ids)
+	}
+
+	_, err = parseJobIDs("12,build")
+	if !errors.Is(err, errInvalidJobID) {
+		t.Fatalf("err = %v, want an invalid job ID", err)
+	}
+	a := &app.App{Config: &app.Config{}}
+	if _, _, err := jobsByIDs(a, "12,build"); exitCode(err) != exitConfig {
+		t.Errorf("exit code %d, want %d", exitCode(err), exitConfig)
+	}
+}
+
+func TestArtifactJobsByIDsWithJobToken(t *testing.T) {
+	cli, err := gitlab.NewClient("http://gitlab.invalid/api/v4", gitlab.WithCredentials(&gitlab.Credentials{Mode: gitlab.AuthJobToken, Token: "job"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &app.App{Config: &app.Config{}, GitlabCli: cli, Project: &gitlab.Project{ID: 1}}
+	// The jobs cannot be read with a job token, they are not looked up.
+	_, jobs, err := artifactJobsByIDs(a, "12,30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 || jobs[0].ID != 12 || jobs[0].Name != "job-12" || jobs[1].ID != 30 || jobs[1].Name != "job-30" {
+		t.Errorf("jobs = %+v, want 12 and 30 named after their IDs", jobs)
+	}
+}
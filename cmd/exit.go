@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
+)
+
+// Exit codes of the failure categories, documented in the README.
+const (
+	exitError        = 1
+	exitConfig       = 2
+	exitAuth         = 3
+	exitTrigger      = 4
+	exitJobsNotFound = 5
+	exitJobFailed    = 6
+	exitTimeout      = 7
+	exitDownload     = 8
+)
+
+// exitCode returns the code of the failure category of the error. Rejected
+// credentials and timeouts are told apart from the step they happened at.
+func exitCode(err error) int {
+	switch {
+	case gitlab.IsAuthError(err):
+		return exitAuth
+	case errors.Is(err, context.DeadlineExceeded):
+		return exitTimeout
+	case errors.Is(err, gitlab.ErrJobsMissing):
+		return exitJobsNotFound
+	case errors.Is(err, gitlab.ErrJobFailed):
+		return exitJobFailed
+	case errors.Is(err, gitlab.ErrArtifactNotFound):
+		return exitDownload
+	}
+	var f *failure
+	if errors.As(err, &f) && f.code != 0 {
+		return f.code
+	}
+	return exitError
+}
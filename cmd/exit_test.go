@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
+	gogitlab "github.com/xanzy/go-gitlab"
+)
+
+func responseError(status int) error {
+	return &gogitlab.ErrorResponse{Response: &http.Response{StatusCode: status}, Message: http.StatusText(status)}
+}
+
+func TestExitCode(t *testing.T) {
+	job := &gitlab.JobInfo{Name: "build"}
+	failed := &gitlab.JobFailedError{Job: job, Status: "failed"}
+	missing := &gitlab.JobsMissingError{Names: []string{"lint"}}
+	noArtifact := &gitlab.ArtifactNotFoundError{Job: job, Err: responseError(http.StatusNotFound)}
+
+	tests := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"other", errors.New("connection refused"), exitError},
+		{"step", fail("triggering the pipeline", errors.New("connection refused")), exitError},
+		{"step code", failWith(exitTrigger, "triggering the pipeline", errors.New("connection refused")), exitTrigger},
+		{"unauthorized", responseError(http.StatusUnauthorized), exitAuth},
+		{"forbidden", fail("triggering the pipeline", responseError(http.StatusForbidden)), exitAuth},
+		{"not found", responseError(http.StatusNotFound), exitError},
+		{"timeout", fail("waiting for the jobs", context.DeadlineExceeded), exitTimeout},
+		{"jobs missing", fail("searching the jobs", missing), exitJobsNotFound},
+		{"job failed", fail("waiting for the jobs", fmt.Errorf("job build: %w", failed)), exitJobFailed},
+		{"download", failWith(exitDownload, "downloading artifacts", errors.New("unexpected EOF")), exitDownload},
+		{"no artifact", fail("downloading artifacts", noArtifact), exitDownload},
+
+		// A category of the cause wins over the code of the step.
+		{"auth over step code", failWith(exitTrigger, "triggering the pipeline", responseError(http.StatusUnauthorized)), exitAuth},
+		{"timeout over step code", failWith(exitDownload, "downloading artifacts", context.DeadlineExceeded), exitTimeout},
+		// Of several causes, rejected credentials win, then timeouts.
+		{"auth over job failed", errors.Join(failed, responseError(http.StatusForbidden)), exitAuth},
+		{"timeout over job failed", errors.Join(failed, context.DeadlineExceeded), exitTimeout},
+		{"jobs missing over job failed", errors.Join(failed, missing), exitJobsNotFound},
+		{"job failed over download", errors.Join(noArtifact, failed), exitJobFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := exitCode(tt.err); code != tt.code {
+				t.Errorf("exitCode(%v) = %d, want %d", tt.err, code, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Command fakegitlab serves a scenario of projects, pipelines and jobs with
+// the GitLab API, to rehearse CI flows without a GitLab instance and to
+// check how clients cope with faults.
+//
+//	fakegitlab -scenario scenario.yml -listen 127.0.0.1:8080
+//
+// The API is served at http://127.0.0.1:8080/api/v4.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab/gitlabtest"
+)
+
+func main() {
+	flags := flag.NewFlagSet("fakegitlab", flag.ExitOnError)
+	scenarioPath := flags.String("scenario", "", "Path to the scenario file")
+	listen := flags.String("listen", "127.0.0.1:8080", "Address to listen on")
+	quiet := flags.Bool("q", false, "Do not log the requests")
+	_ = flags.Parse(os.Args[1:])
+
+	log := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	if err := run(log, *scenarioPath, *listen, *quiet); err != nil {
+		log.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(log *slog.Logger, scenarioPath, listen string, quiet bool) error {
+	if scenarioPath == "" {
+		return fmt.Errorf("a scenario file is required, see -scenario")
+	}
+	sc, err := loadScenario(scenarioPath)
+	if err != nil {
+		return err
+	}
+
+	srv := gitlabtest.NewUnstartedServer()
+	if err := sc.apply(srv); err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+	srv.Listener.Close()
+	srv.Listener = listener
+	if !quiet {
+		srv.Config.Handler = logRequests(log, srv.Config.Handler)
+	}
+	srv.Start()
+	defer srv.Close()
+
+	log.Info("serving the scenario", "scenario", scenarioPath, "api", srv.APIURL())
+	for _, p := range sc.Projects {
+		log.Info("project", "path", p.Path)
+	}
+	for _, pipeline := range srv.Pipelines() {
+		log.Info("pipeline", "project", pipeline.Project().Path, "id", pipeline.ID, "ref", pipeline.Ref)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	<-stop
+	return nil
+}
+
+// statusRecorder keeps the status of the response for the request log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func logRequests(log *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			log.Info("request",
+				"method", r.Method,
+				"path", r.URL.EscapedPath(),
+				"status", recorder.status,
+				"duration_ms", time.Since(start).Milliseconds(),
+			)
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
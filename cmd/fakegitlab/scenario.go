@@ -0,0 +1,239 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab/gitlabtest"
+)
+
+// scenario describes what the fake server serves.
+type scenario struct {
+	Token        string            `yaml:"token"`
+	TriggerToken string            `yaml:"trigger_token"`
+	Projects     []scenarioProject `yaml:"projects"`
+	Faults       []scenarioFault   `yaml:"faults"`
+}
+
+type scenarioProject struct {
+	Path          string            `yaml:"path"`
+	DefaultBranch string            `yaml:"default_branch"`
+	Refs          []string          `yaml:"refs"`
+	Files         map[string]string `yaml:"files"`
+	CIConfigPath  string            `yaml:"ci_config_path"`
+	// Pipelines which exist when the server starts.
+	Pipelines []scenarioPipeline `yaml:"pipelines"`
+	// Jobs of the pipelines created through the API.
+	Jobs []scenarioJob `yaml:"jobs"`
+}
+
+type scenarioPipeline struct {
+	Ref     string           `yaml:"ref"`
+	Jobs    []scenarioJob    `yaml:"jobs"`
+	Bridges []scenarioBridge `yaml:"bridges"`
+}
+
+type scenarioJob struct {
+	Name          string            `yaml:"name"`
+	Stage         string            `yaml:"stage"`
+	Timeline      []string          `yaml:"timeline"`
+	AllowFailure  bool              `yaml:"allow_failure"`
+	FailureReason string            `yaml:"failure_reason"`
+	Trace         string            `yaml:"trace"`
+	Artifact      *scenarioArtifact `yaml:"artifact"`
+	RetryTimeline []string          `yaml:"retry_timeline"`
+}
+
+// scenarioArtifact is a zip of the files, the content of a local file, or
+// size pseudo-random bytes which are the same on every run.
+type scenarioArtifact struct {
+	Files  map[string]string `yaml:"files"`
+	Path   string            `yaml:"path"`
+	Size   int               `yaml:"size"`
+	Delay  time.Duration     `yaml:"delay"`
+	Broken bool              `yaml:"broken"`
+}
+
+type scenarioBridge struct {
+	Name   string `yaml:"name"`
+	Stage  string `yaml:"stage"`
+	Status string `yaml:"status"`
+	// Index of the downstream pipeline in the pipelines of the project.
+	Downstream *int `yaml:"downstream"`
+}
+
+type scenarioFault struct {
+	Method     string        `yaml:"method"`
+	Path       string        `yaml:"path"`
+	Skip       int           `yaml:"skip"`
+	Times      int           `yaml:"times"`
+	Status     int           `yaml:"status"`
+	RetryAfter time.Duration `yaml:"retry_after"`
+	Delay      time.Duration `yaml:"delay"`
+	Rate       int           `yaml:"rate"`
+	Truncate   bool          `yaml:"truncate"`
+}
+
+func loadScenario(path string) (*scenario, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sc := new(scenario)
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(sc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return sc, nil
+}
+
+// apply sets the server up. Artifacts are built once, here.
+func (sc *scenario) apply(srv *gitlabtest.Server) error {
+	srv.Token, srv.TriggerToken = sc.Token, sc.TriggerToken
+
+	created := make(map[string][]*builtJob)
+	for _, p := range sc.Projects {
+		project := srv.AddProject(p.Path)
+		if p.DefaultBranch != "" {
+			project.DefaultBranch = p.DefaultBranch
+		}
+		project.Refs, project.CIConfigPath = p.Refs, p.CIConfigPath
+		for name, content := range p.Files {
+			project.Files[name] = content
+		}
+
+		pipelines := make([]*gitlabtest.Pipeline, 0, len(p.Pipelines))
+		for _, sp := range p.Pipelines {
+			ref := sp.Ref
+			if ref == "" {
+				ref = project.DefaultBranch
+			}
+			pipeline := project.AddPipeline(ref)
+			jobs, err := buildJobs(sp.Jobs)
+			if err != nil {
+				return fmt.Errorf("project %s: %w", p.Path, err)
+			}
+			for _, job := range jobs {
+				job.add(pipeline)
+			}
+			pipelines = append(pipelines, pipeline)
+		}
+		// Bridges may point at any pipeline of the project.
+		for i, sp := range p.Pipelines {
+			for _, b := range sp.Bridges {
+				var downstream *gitlabtest.Pipeline
+				if b.Downstream != nil {
+					if *b.Downstream < 0 || *b.Downstream >= len(pipelines) {
+						return fmt.Errorf("project %s: bridge %s: no pipeline %d", p.Path, b.Name, *b.Downstream)
+					}
+					downstream = pipelines[*b.Downstream]
+				}
+				pipelines[i].AddBridge(b.Name, b.Stage, b.Status, downstream)
+			}
+		}
+
+		jobs, err := buildJobs(p.Jobs)
+		if err != nil {
+			return fmt.Errorf("project %s: %w", p.Path, err)
+		}
+		created[p.Path] = jobs
+	}
+
+	srv.OnPipelineCreated(func(pipeline *gitlabtest.Pipeline) {
+		for _, job := range created[pipeline.Project().Path] {
+			job.add(pipeline)
+		}
+	})
+
+	for _, f := range sc.Faults {
+		srv.Inject(gitlabtest.Fault{
+			Method:     f.Method,
+			Pattern:    f.Path,
+			Skip:       f.Skip,
+			Times:      f.Times,
+			Status:     f.Status,
+			RetryAfter: f.RetryAfter,
+			Delay:      f.Delay,
+			Rate:       f.Rate,
+			Truncate:   f.Truncate,
+		})
+	}
+	return nil
+}
+
+// builtJob is a job of the scenario with its artifact ready.
+type builtJob struct {
+	scenarioJob
+	artifact []byte
+}
+
+func buildJobs(jobs []scenarioJob) ([]*builtJob, error) {
+	built := make([]*builtJob, 0, len(jobs))
+	for _, job := range jobs {
+		b := &builtJob{scenarioJob: job}
+		if job.Artifact != nil {
+			var err error
+			if b.artifact, err = job.Artifact.build(); err != nil {
+				return nil, fmt.Errorf("job %s: %w", job.Name, err)
+			}
+		}
+		built = append(built, b)
+	}
+	return built, nil
+}
+
+func (b *builtJob) add(pipeline *gitlabtest.Pipeline) {
+	stage := b.Stage
+	if stage == "" {
+		stage = "test"
+	}
+	job := pipeline.AddJob(b.Name, stage, b.Timeline...)
+	job.AllowFailure = b.AllowFailure
+	job.FailureReason = b.FailureReason
+	job.Trace = b.Trace
+	job.RetryTimeline = b.RetryTimeline
+	job.Artifact = b.artifact
+	if b.Artifact != nil {
+		job.ArtifactDelay, job.BrokenArtifact = b.Artifact.Delay, b.Artifact.Broken
+	}
+}
+
+func (a *scenarioArtifact) build() ([]byte, error) {
+	switch {
+	case a.Path != "":
+		return os.ReadFile(a.Path)
+	case a.Size > 0:
+		content := make([]byte, a.Size)
+		_, err := rand.New(rand.NewSource(int64(a.Size))).Read(content)
+		return content, err
+	}
+
+	buf := new(bytes.Buffer)
+	archive := zip.NewWriter(buf)
+	names := make([]string, 0, len(a.Files))
+	for name := range a.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f, err := archive.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write([]byte(a.Files[name])); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
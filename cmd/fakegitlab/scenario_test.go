@@ -0,0 +1,156 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab/gitlabtest"
+)
+
+func TestExampleScenario(t *testing.T) {
+	sc, err := loadScenario("example.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sc.Faults) != 3 {
+		t.Errorf("%d faults, want 3", len(sc.Faults))
+	}
+	// The faults are left out, they only slow the checks down.
+	sc.Faults = nil
+	srv := gitlabtest.NewServer()
+	defer srv.Close()
+	if err := sc.apply(srv); err != nil {
+		t.Fatal(err)
+	}
+
+	existing := srv.Pipelines()
+	if len(existing) != 2 {
+		t.Fatalf("%d pipelines, want 2", len(existing))
+	}
+	// The bridge of the first pipeline leads to the second one.
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/projects/%d/pipelines/%d/bridges", srv.APIURL(), existing[0].Project().ID, existing[0].ID), nil)
+	req.Header.Set("PRIVATE-TOKEN", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var bridges []struct {
+		Name               string `json:"name"`
+		DownstreamPipeline struct {
+			ID int `json:"id"`
+		} `json:"downstream_pipeline"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&bridges); err != nil {
+		t.Fatal(err)
+	}
+	if len(bridges) != 1 || bridges[0].Name != "deploy" || bridges[0].DownstreamPipeline.ID != existing[1].ID {
+		t.Errorf("bridges %+v, want deploy leading to pipeline %d", bridges, existing[1].ID)
+	}
+
+	// Pipelines created through the API get the jobs of the project.
+	cli, err := srv.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	project, err := cli.ResolveProject("group/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline := &gitlab.PipelineInfo{Project: project, Branch: "develop"}
+	if pipeline.ID, err = cli.TriggerPipeline(pipeline); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := cli.FindJobs(context.Background(), pipeline, &gitlab.JobsSearch{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(jobs))
+	for _, job := range jobs {
+		names = append(names, job.Name)
+	}
+	if strings.Join(names, ",") != "build,test,package" {
+		t.Errorf("jobs %v, want build, test and package", names)
+	}
+
+	created := srv.Pipeline(*pipeline.ID)
+	archive, err := zip.NewReader(bytes.NewReader(created.Job("build").Artifact), int64(len(created.Job("build").Artifact)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make([]string, 0, len(archive.File))
+	for _, f := range archive.File {
+		files = append(files, f.Name)
+	}
+	sort.Strings(files)
+	if strings.Join(files, ",") != "README.md,bin/app" {
+		t.Errorf("build artifact has %v, want README.md and bin/app", files)
+	}
+	if size := len(created.Job("package").Artifact); size != 1048576 {
+		t.Errorf("package artifact of %d bytes, want 1048576", size)
+	}
+}
+
+func TestScenarioErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		scenario string
+		err      string
+	}{
+		{"unknown field", "projects:\n  - path: group/repo\n    branch: main\n", "field branch not found"},
+		{
+			"downstream out of range",
+			"projects:\n  - path: group/repo\n    pipelines:\n      - bridges:\n          - name: deploy\n            downstream: 1\n",
+			"bridge deploy: no pipeline 1",
+		},
+		{
+			"negative downstream",
+			"projects:\n  - path: group/repo\n    pipelines:\n      - bridges:\n          - name: deploy\n            downstream: -1\n",
+			"bridge deploy: no pipeline -1",
+		},
+		{
+			"missing artifact file",
+			"projects:\n  - path: group/repo\n    jobs:\n      - name: build\n        artifact:\n          path: missing.zip\n",
+			"job build: open missing.zip",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "scenario.yml")
+			if err := os.WriteFile(path, []byte(tt.scenario), 0600); err != nil {
+				t.Fatal(err)
+			}
+			sc, err := loadScenario(path)
+			if err == nil {
+				srv := gitlabtest.NewServer()
+				defer srv.Close()
+				err = sc.apply(srv)
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("err = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestScenarioArtifactSizeIsStable(t *testing.T) {
+	a := &scenarioArtifact{Size: 4096}
+	first, err := a.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := a.build()
+	if len(first) != 4096 || !bytes.Equal(first, second) {
+		t.Error("artifacts of a size differ between builds")
+	}
+}
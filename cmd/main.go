@@ -2,108 +2,111 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
-	"sync"
-	"time"
 
 	"github.com/Asideron/gitlab-artifacts-downloader/app"
-	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
 )
 
+// failure is an error together with the step it happened at.
+type failure struct {
+	step string
+	err  error
+	// Exit code of the step, see exitCode.
+	code int
+}
+
+func fail(step string, err error) error {
+	return &failure{step: step, err: err}
+}
+
+// failWith is fail for a step with its own exit code.
+func failWith(code int, step string, err error) error {
+	return &failure{step: step, err: err, code: code}
+}
+
+func (f *failure) Error() string {
+	return fmt.Sprintf("An error occurred while %s: %s", f.step, f.err.Error())
+}
+
+func (f *failure) Unwrap() error {
+	return f.err
+}
+
+// out shows the error the command failed with, in the configured output
+// format once the configuration is loaded. It is the output of the app once
+// there is one, text lines until then.
+var out app.Output
+
+// shown is an error the command has already reported.
+type shown struct {
+	error
+}
+
+func (s shown) Unwrap() error {
+	return s.error
+}
+
 func main() {
-	app, err := app.NewApp(context.Background())
-	if err != nil {
-		fmt.Printf("An error occurred while creating an app instance: %s\n", err.Error())
-		os.Exit(-1)
+	args := os.Args[1:]
+	if len(args) != 0 && (args[0] == "help" || args[0] == "-h" || args[0] == "--help") {
+		printUsage()
+		return
 	}
 
-	pipeline := &gitlab.PipelineInfo{
-		Project:    app.Config.Project,
-		Repository: app.Config.Repository,
-		Branch:     app.Config.Branch,
-		KeyVals:    app.Config.KeyValues,
+	cmd, args := findCommand(args)
+	flags := flag.NewFlagSet("ci-downloader "+cmd.name, flag.ContinueOnError)
+	flags.SetOutput(os.Stdout)
+	flags.Usage = func() {
+		fmt.Printf("Usage: ci-downloader %s [flags]\n\n%s\n\n", cmd.name, cmd.summary)
+		flags.PrintDefaults()
 	}
+	action := cmd.setup(flags)
 
-	jobsSearch := &gitlab.JobsSearch{
-		Jobs: &app.Config.Jobs,
+	if err := run(cmd, flags, action, args); err != nil {
+		if !errors.As(err, &shown{}) {
+			if out == nil {
+				out = app.NewOutput(app.OutputText, os.Stdout)
+			}
+			out.Emit(&app.Event{Type: app.EventError, Error: err.Error(), Text: err.Error()})
+		}
+		os.Exit(exitCode(err))
 	}
+}
 
-	pipeline.ID, err = app.GitlabCli.TriggerPipeline(pipeline)
-	if err != nil {
-		fmt.Printf("An error occurred while triggering a pipeline: %s\n", err.Error())
-		os.Exit(-1)
+func run(cmd *command, flags *flag.FlagSet, action func(*app.App) error, args []string) error {
+	ctx := context.Background()
+
+	config, err := app.LoadConfig(flags, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
 	}
-	fmt.Println("Pipeline was triggered.")
-
-	jobs, err := app.GitlabCli.FindJobs(
-		app.Ctx,
-		pipeline,
-		jobsSearch,
-		&gitlab.FindJobsOpts{CancelUnneededJobs: true},
-	)
 	if err != nil {
-		fmt.Printf("An error occurred while getting jobs: %s\n", err.Error())
-		os.Exit(-1)
+		return failWith(exitConfig, "loading the configuration", err)
 	}
-	fmt.Println("Jobs were located.")
-
-	artifacts := make(chan *gitlab.Artifact)
-
-	{
-		var wg sync.WaitGroup
-		for _, job := range jobs {
-			wg.Add(1)
-			go func(job *gitlab.JobInfo) {
-				defer wg.Done()
-				ctx, cancel := context.WithTimeout(app.Ctx, app.Config.Timeout)
-				defer cancel()
-				artifact, err := app.GitlabCli.WaitJobArtifact(ctx, pipeline, job)
-				if err != nil {
-					fmt.Printf("An error occurred while getting the artifact %s: %s\n", job.Name, err.Error())
-					return
-				}
-				artifacts <- artifact
-				fmt.Printf("Got artifact %s. Downloading...\n", artifact.Name)
-			}(job)
-		}
-
-		go func() {
-			wg.Wait()
-			defer close(artifacts)
-		}()
+	out = app.NewOutput(config.Output, os.Stdout)
+	if flags.NArg() != 0 {
+		printUsage()
+		return failWith(exitConfig, "parsing the arguments", fmt.Errorf("%w: %v", errUnexpectedArgs, flags.Args()))
+	}
+	if cmd.offline {
+		return action(&app.App{Ctx: ctx, Config: config, Out: out, Log: app.NewLogger(config, app.LogWriter(out, os.Stderr))})
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		ticker := time.NewTicker(time.Duration(30) * time.Second)
-		defer ticker.Stop()
-
-		defer wg.Done()
-
-		for {
-			select {
-			case artifact, open := <-artifacts:
-				if !open {
-					return
-				}
-				wg.Add(1)
-				go func() {
-					defer wg.Done()
-					err := app.GitlabCli.DownloadArtifact(artifact, app.Config.Folder)
-					if err != nil {
-						fmt.Printf("An error occurred while downloading the artifact %s: %s\n", artifact.Name, err.Error())
-						return
-					}
-					fmt.Printf("Artifact %s was downloaded.\n", artifact.Name)
-				}()
-			case <-ticker.C:
-				fmt.Println("Waiting...")
-			}
-		}
-	}()
-	wg.Wait()
-
-	fmt.Println("Work is finished.")
+	if err := config.Validate(cmd.requires...); err != nil {
+		flags.Usage()
+		return failWith(exitConfig, "loading the configuration", err)
+	}
+	app, err := app.NewApp(ctx, config)
+	if err != nil {
+		return failWith(exitConfig, "creating an app instance", err)
+	}
+	// The error is shown through the live view of the run, if any.
+	out = app.Out
+	if app.Config.TokenSource != "" {
+		app.Log.Info("using the token", "source", app.Config.TokenSource)
+	}
+	return action(app)
 }
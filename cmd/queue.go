@@ -0,0 +1,90 @@
+package main
+
+import (
+	"container/heap"
+	"sync"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
+)
+
+// download is the artifact of a finished job waiting for a worker.
+type download struct {
+	job *gitlab.JobInfo
+	// Order the job finished in, ties are broken with it.
+	seq int
+}
+
+// downloadQueue hands the ready artifacts to the workers, the first one
+// according to first goes first.
+type downloadQueue struct {
+	first func(a, b *gitlab.JobInfo) bool
+
+	mu      sync.Mutex
+	ready   *sync.Cond
+	pending []*download
+	seq     int
+	closed  bool
+}
+
+func newDownloadQueue(first func(a, b *gitlab.JobInfo) bool) *downloadQueue {
+	q := &downloadQueue{first: first}
+	q.ready = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *downloadQueue) Push(d *download) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	d.seq = q.seq
+	q.seq++
+	heap.Push((*downloadHeap)(q), d)
+	q.ready.Signal()
+}
+
+// Pop blocks until an artifact is ready, false is returned once the queue is
+// closed and empty.
+func (q *downloadQueue) Pop() (*download, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.pending) == 0 && !q.closed {
+		q.ready.Wait()
+	}
+	if len(q.pending) == 0 {
+		return nil, false
+	}
+	return heap.Pop((*downloadHeap)(q)).(*download), true
+}
+
+// Close tells the workers no more artifacts are coming.
+func (q *downloadQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.ready.Broadcast()
+}
+
+// downloadHeap orders the pending downloads of the queue, its lock is held.
+type downloadHeap downloadQueue
+
+func (h *downloadHeap) Len() int { return len(h.pending) }
+
+func (h *downloadHeap) Less(i, j int) bool {
+	a, b := h.pending[i], h.pending[j]
+	switch {
+	case h.first(a.job, b.job):
+		return true
+	case h.first(b.job, a.job):
+		return false
+	}
+	return a.seq < b.seq
+}
+
+func (h *downloadHeap) Swap(i, j int) { h.pending[i], h.pending[j] = h.pending[j], h.pending[i] }
+
+func (h *downloadHeap) Push(x any) { h.pending = append(h.pending, x.(*download)) }
+
+func (h *downloadHeap) Pop() any {
+	last := h.pending[len(h.pending)-1]
+	h.pending = h.pending[:len(h.pending)-1]
+	return last
+}
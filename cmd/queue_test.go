@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/app"
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
+)
+
+func TestDownloadQueueOrder(t *testing.T) {
+	// Jobs in the order they finish.
+	jobs := []*gitlab.JobInfo{
+		{Name: "docs", ArtifactSize: 300},
+		{Name: "build", ArtifactSize: 900},
+		{Name: "test", ArtifactSize: 100},
+		{Name: "lint"},
+		{Name: "report", ArtifactSize: 100},
+	}
+	tests := []struct {
+		order app.DownloadOrder
+		want  string
+	}{
+		{app.OrderReady, "docs build test lint report"},
+		// Unknown sizes go first, ties in the order the jobs finished.
+		{app.OrderSmallest, "lint test report docs build"},
+		// Jobs which are not listed go last.
+		{app.OrderListed, "build test docs lint report"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.order), func(t *testing.T) {
+			cfg := &app.Config{DownloadOrder: tt.order, Jobs: []string{"build", "test", "docs"}}
+			queue := newDownloadQueue(cfg.DownloadFirst)
+			for _, job := range jobs {
+				queue.Push(&download{job: job})
+			}
+			queue.Close()
+
+			names := make([]string, 0, len(jobs))
+			for {
+				d, ok := queue.Pop()
+				if !ok {
+					break
+				}
+				names = append(names, d.job.Name)
+			}
+			if got := strings.Join(names, " "); got != tt.want {
+				t.Errorf("downloads %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadQueuePopWaits(t *testing.T) {
+	queue := newDownloadQueue((&app.Config{}).DownloadFirst)
+	popped := make(chan string)
+	go func() {
+		for {
+			d, ok := queue.Pop()
+			if !ok {
+				close(popped)
+				return
+			}
+			popped <- d.job.Name
+		}
+	}()
+
+	select {
+	case name := <-popped:
+		t.Fatalf("popped %s from an empty queue", name)
+	case <-time.After(10 * time.Millisecond):
+	}
+	queue.Push(&download{job: &gitlab.JobInfo{Name: "build"}})
+	if name := <-popped; name != "build" {
+		t.Errorf("popped %s, want build", name)
+	}
+	queue.Close()
+	if _, ok := <-popped; ok {
+		t.Error("popped after the queue was closed")
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/app"
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
+)
+
+func newPipeline(app *app.App) *gitlab.PipelineInfo {
+	return &gitlab.PipelineInfo{
+		Project: app.Project,
+		Branch:  app.Config.Branch,
+		KeyVals: app.Config.KeyValues,
+	}
+}
+
+// prepareInputs validates the configured inputs against the project's spec.
+func prepareInputs(app *app.App, pipeline *gitlab.PipelineInfo) error {
+	if len(app.Config.Inputs) == 0 {
+		return nil
+	}
+	spec, err := app.GitlabCli.GetInputsSpec(pipeline)
+	if err != nil {
+		return fail("reading the pipeline inputs spec", err)
+	}
+	pipeline.Inputs, err = gitlab.ValidateInputs(spec, app.Config.Inputs)
+	if err != nil {
+		return failWith(exitConfig, "validating the pipeline inputs", err)
+	}
+	return nil
+}
+
+// triggerPipeline runs the preflight checks, unless disabled, and creates
+// the pipeline.
+func triggerPipeline(app *app.App, pipeline *gitlab.PipelineInfo) error {
+	if !app.Config.SkipPreflight {
+		jobs, atLeast := app.Config.PreflightJobs()
+		report := app.GitlabCli.Preflight(pipeline, jobs, atLeast)
+		for _, warning := range report.Warnings {
+			app.Log.Warn(warning)
+		}
+		if err := report.Err(); err != nil {
+			return failWith(exitTrigger, "checking the pipeline", err)
+		}
+		app.Log.Info("preflight checks passed")
+	}
+
+	var err error
+	pipeline.ID, err = app.GitlabCli.TriggerPipeline(pipeline)
+	if err != nil {
+		return failWith(exitTrigger, "triggering a pipeline", err)
+	}
+	return nil
+}
+
+// messages returns where the human readable messages go, stderr when stdout
+// carries the JSON events.
+func messages(app *app.App) io.Writer {
+	if app.Config.JSONOutput() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// runCommand is the whole flow: trigger a pipeline, cancel the jobs that are
+// not needed, wait for the needed ones and download their artifacts. It ends
+// with a summary of the jobs, also when the flow fails.
+func runCommand(app *app.App) error {
+	err := collectArtifacts(app)
+	if app.Config.DryRun {
+		return err
+	}
+	if err != nil {
+		app.Error(nil, err, err.Error())
+	}
+	app.Summarize(err)
+	if err != nil {
+		return shown{err}
+	}
+	// Every requested artifact has to be delivered.
+	if err := app.Report.Err(); err != nil {
+		return shown{failWith(exitDownload, "collecting artifacts", err)}
+	}
+	return nil
+}
+
+func collectArtifacts(app *app.App) error {
+	pipeline := newPipeline(app)
+
+	jobsSearch := &gitlab.JobsSearch{
+		Jobs: &app.Config.Jobs,
+	}
+
+	// Jobs of the running pipeline are its siblings, they must not be canceled.
+	cancelUnneededJobs := app.Config.PipelineID == 0
+
+	// Checked up front, a pipeline triggered with a token which cannot wait
+	// for its jobs would be left behind.
+	if err := app.GitlabCli.CanWaitJobs(); err != nil {
+		return failWith(exitAuth, "checking the credentials", fmt.Errorf("%w: %w", errNoAPIToken, err))
+	}
+
+	if app.Config.PipelineID == 0 {
+		if err := prepareInputs(app, pipeline); err != nil {
+			return err
+		}
+	}
+
+	if app.Config.DryRun {
+		if err := app.DryRun(pipeline, cancelUnneededJobs, messages(app)); err != nil {
+			return fail("checking the pipeline", err)
+		}
+		return nil
+	}
+
+	if app.Config.PipelineID != 0 {
+		pipeline.ID = &app.Config.PipelineID
+		app.PipelineUsed(app.Config.PipelineID)
+	} else {
+		if err := triggerPipeline(app, pipeline); err != nil {
+			return err
+		}
+		app.PipelineCreated(*pipeline.ID)
+	}
+	app.Report.SetPipeline(*pipeline.ID)
+
+	jobs, err := app.GitlabCli.FindJobs(
+		app.Ctx,
+		pipeline,
+		jobsSearch,
+		&gitlab.FindJobsOpts{CancelUnneededJobs: cancelUnneededJobs},
+	)
+	var missingErr *gitlab.JobsMissingError
+	if err != nil && !errors.As(err, &missingErr) {
+		return fail("getting jobs", err)
+	}
+	if missingErr != nil {
+		// Missing jobs only stop the run when the policy needs them.
+		for _, name := range missingErr.Names {
+			if app.Config.Policy.NeedsEvery() && !app.Config.IsOptional(name) {
+				return fail("getting jobs", err)
+			}
+		}
+		for _, name := range missingErr.Names {
+			missing := &gitlab.JobInfo{Name: name}
+			err := &gitlab.JobsMissingError{Names: []string{name}}
+			app.Error(missing, err, fmt.Sprintf("Job %s was not found.", name))
+			app.Report.AddJob(missing, nil, err)
+		}
+	}
+	app.JobsFound(jobs)
+
+	// Jobs are waited for all at once, their artifacts are downloaded by a
+	// bounded number of workers.
+	queue := newDownloadQueue(app.Config.DownloadFirst)
+	{
+		var wg sync.WaitGroup
+		for _, job := range jobs {
+			wg.Add(1)
+			go func(job *gitlab.JobInfo) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(app.Ctx, app.Config.Timeout)
+				defer cancel()
+				if err := app.GitlabCli.WaitJob(ctx, pipeline, job); err != nil {
+					app.Error(job, err, fmt.Sprintf("An error occurred while getting the artifact %s: %s", job.Name, err.Error()))
+					app.Report.AddJob(job, nil, err)
+					return
+				}
+				queue.Push(&download{job: job})
+			}(job)
+		}
+
+		go func() {
+			wg.Wait()
+			queue.Close()
+		}()
+	}
+	done := startDownloads(app, pipeline, queue)
+
+	ticker := time.NewTicker(time.Duration(30) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			// Failed downloads are in the report.
+			return nil
+		case <-ticker.C:
+			app.Waiting()
+		}
+	}
+}
+
+// startDownloads runs the workers downloading the artifacts of the queue.
+// The errors of the downloads are sent joined once the queue is closed and
+// drained.
+func startDownloads(app *app.App, pipeline *gitlab.PipelineInfo, queue *downloadQueue) <-chan error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for i := 0; i < app.Config.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				d, ok := queue.Pop()
+				if !ok {
+					return
+				}
+				if err := downloadArtifact(app, pipeline, d.job); err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	done := make(chan error, 1)
+	go func() {
+		wg.Wait()
+		done <- errors.Join(errs...)
+	}()
+	return done
+}
+
+// downloadArtifact fetches the artifact of the finished job and writes it to
+// the folder. The download has its own deadline, the time spent in the queue
+// does not count.
+func downloadArtifact(app *app.App, pipeline *gitlab.PipelineInfo, job *gitlab.JobInfo) error {
+	ctx, cancel := context.WithTimeout(app.Ctx, app.Config.Timeout)
+	defer cancel()
+	artifact, err := app.GitlabCli.GetArtifact(ctx, pipeline, job)
+	if err != nil {
+		app.Error(job, err, fmt.Sprintf("An error occurred while getting the artifact %s: %s", job.Name, err.Error()))
+		app.Report.AddJob(job, nil, err)
+		return err
+	}
+	app.ArtifactReady(job)
+	file, err := app.GitlabCli.DownloadArtifact(artifact, app.Config.Folder)
+	if err != nil {
+		app.Error(job, err, fmt.Sprintf("An error occurred while downloading the artifact %s: %s", job.Name, err.Error()))
+		app.Report.AddJob(job, nil, err)
+		return err
+	}
+	app.ArtifactDownloaded(job, file, fmt.Sprintf("Artifact %s was downloaded.", job.Name))
+	app.Report.AddJob(job, file, nil)
+	return nil
+}
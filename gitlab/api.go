@@ -0,0 +1,112 @@
+package gitlab
+
+import (
+	"bytes"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/xanzy/go-gitlab"
+)
+
+// The interfaces below are the parts of the go-gitlab services the client
+// calls. The services of *gitlab.Client satisfy them, tests may pass their
+// own implementations with WithAPI.
+
+type PipelinesService interface {
+	GetPipeline(pid interface{}, pipeline int, options ...gitlab.RequestOptionFunc) (*gitlab.Pipeline, *gitlab.Response, error)
+	CancelPipelineBuild(pid interface{}, pipeline int, options ...gitlab.RequestOptionFunc) (*gitlab.Pipeline, *gitlab.Response, error)
+	RetryPipelineBuild(pid interface{}, pipeline int, options ...gitlab.RequestOptionFunc) (*gitlab.Pipeline, *gitlab.Response, error)
+}
+
+type JobsService interface {
+	ListPipelineJobs(pid interface{}, pipelineID int, opts *gitlab.ListJobsOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Job, *gitlab.Response, error)
+	GetJob(pid interface{}, jobID int, options ...gitlab.RequestOptionFunc) (*gitlab.Job, *gitlab.Response, error)
+	CancelJob(pid interface{}, jobID int, options ...gitlab.RequestOptionFunc) (*gitlab.Job, *gitlab.Response, error)
+	RetryJob(pid interface{}, jobID int, options ...gitlab.RequestOptionFunc) (*gitlab.Job, *gitlab.Response, error)
+	GetTraceFile(pid interface{}, jobID int, options ...gitlab.RequestOptionFunc) (*bytes.Reader, *gitlab.Response, error)
+}
+
+type BridgesService interface {
+	ListPipelineBridges(pid interface{}, pipelineID int, opts *gitlab.ListJobsOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Bridge, *gitlab.Response, error)
+}
+
+type ArtifactsService interface {
+	GetJobArtifacts(pid interface{}, jobID int, options ...gitlab.RequestOptionFunc) (*bytes.Reader, *gitlab.Response, error)
+}
+
+type ProjectsService interface {
+	GetProject(pid interface{}, opt *gitlab.GetProjectOptions, options ...gitlab.RequestOptionFunc) (*gitlab.Project, *gitlab.Response, error)
+}
+
+type CommitsService interface {
+	GetCommit(pid interface{}, sha string, options ...gitlab.RequestOptionFunc) (*gitlab.Commit, *gitlab.Response, error)
+}
+
+type RepositoryFilesService interface {
+	GetRawFile(pid interface{}, fileName string, opt *gitlab.GetRawFileOptions, options ...gitlab.RequestOptionFunc) ([]byte, *gitlab.Response, error)
+}
+
+// Requester sends the requests go-gitlab has no service method for, such as
+// creating a pipeline with inputs.
+type Requester interface {
+	NewRequest(method, path string, opt interface{}, options []gitlab.RequestOptionFunc) (*retryablehttp.Request, error)
+	Do(req *retryablehttp.Request, v interface{}) (*gitlab.Response, error)
+}
+
+// API groups the services the client calls.
+type API struct {
+	Requester
+	Pipelines       PipelinesService
+	Jobs            JobsService
+	Bridges         BridgesService
+	Artifacts       ArtifactsService
+	Projects        ProjectsService
+	Commits         CommitsService
+	RepositoryFiles RepositoryFilesService
+}
+
+func newAPI(client *gitlab.Client) API {
+	return API{
+		Requester:       client,
+		Pipelines:       client.Pipelines,
+		Jobs:            client.Jobs,
+		Bridges:         client.Jobs,
+		Artifacts:       client.Jobs,
+		Projects:        client.Projects,
+		Commits:         client.Commits,
+		RepositoryFiles: client.RepositoryFiles,
+	}
+}
+
+func (api *API) empty() bool {
+	return api.Requester == nil && api.Pipelines == nil && api.Jobs == nil &&
+		api.Bridges == nil && api.Artifacts == nil && api.Projects == nil &&
+		api.Commits == nil && api.RepositoryFiles == nil
+}
+
+// override replaces the services with the ones set in other.
+func (api *API) override(other API) {
+	if other.Requester != nil {
+		api.Requester = other.Requester
+	}
+	if other.Pipelines != nil {
+		api.Pipelines = other.Pipelines
+	}
+	if other.Jobs != nil {
+		api.Jobs = other.Jobs
+	}
+	if other.Bridges != nil {
+		api.Bridges = other.Bridges
+	}
+	if other.Artifacts != nil {
+		api.Artifacts = other.Artifacts
+	}
+	if other.Projects != nil {
+		api.Projects = other.Projects
+	}
+	if other.Commits != nil {
+		api.Commits = other.Commits
+	}
+	if other.RepositoryFiles != nil {
+		api.RepositoryFiles = other.RepositoryFiles
+	}
+}
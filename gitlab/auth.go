@@ -0,0 +1,120 @@
+package gitlab
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/xanzy/go-gitlab"
+	"golang.org/x/oauth2"
+)
+
+type AuthMode string
+
+const (
+	// Personal, project or group access token sent as PRIVATE-TOKEN.
+	AuthPersonalToken AuthMode = "pat"
+	// OAuth2 access token sent as a bearer token.
+	AuthOAuth AuthMode = "oauth"
+	// CI_JOB_TOKEN of a running job.
+	AuthJobToken AuthMode = "job"
+	// Project pipeline trigger token, it can only trigger pipelines.
+	AuthTriggerToken AuthMode = "trigger"
+)
+
+// Credentials is a token together with the way it is presented to GitLab.
+type Credentials struct {
+	Mode  AuthMode
+	Token string
+	// Optional source of fresh OAuth2 tokens, Token is ignored when it is set.
+	TokenSource oauth2.TokenSource
+}
+
+// newAPIClient creates a go-gitlab client sending its requests through the
+// transport.
+func newAPIClient(baseURL string, creds *Credentials, transport http.RoundTripper) (*gitlab.Client, error) {
+	options := goGitlabOptions(baseURL, transport)
+	switch creds.Mode {
+	case AuthPersonalToken:
+		return gitlab.NewClient(creds.Token, options...)
+	case AuthOAuth:
+		if creds.TokenSource != nil {
+			// The transport overrides the bearer token set by go-gitlab.
+			httpClient := &http.Client{
+				Transport: &oauth2.Transport{
+					Source: creds.TokenSource,
+					Base:   transport,
+				},
+			}
+			options = append(options, gitlab.WithHTTPClient(httpClient))
+		}
+		return gitlab.NewOAuthClient(creds.Token, options...)
+	case AuthJobToken:
+		return gitlab.NewJobClient(creds.Token, options...)
+	default:
+		return nil, fmt.Errorf("%w: %q", errUnknownAuthMode, creds.Mode)
+	}
+}
+
+// operation is a group of API calls that share the same access rules.
+type operation string
+
+const (
+	opCreatePipeline operation = "create a pipeline"
+	opReadPipeline   operation = "read pipelines and jobs"
+	opManageJobs     operation = "cancel or retry jobs"
+	opReadProject    operation = "read the project"
+	opReadArtifacts  operation = "read job artifacts"
+)
+
+// allowed tells whether the API credential may call the operation's endpoints.
+// A job token is only accepted by a small set of endpoints, artifacts among them.
+func (cli *GitlabClient) allowed(op operation) error {
+	switch cli.auth {
+	case AuthPersonalToken, AuthOAuth:
+		return nil
+	case AuthJobToken:
+		if op == opReadArtifacts {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: cannot %s with %q credentials", errOperationNotAllowed, op, cli.auth)
+}
+
+// CanWaitJobs returns an error when the credentials cannot list and poll the
+// jobs of a pipeline, e.g. CI_JOB_TOKEN or a trigger token alone.
+func (cli *GitlabClient) CanWaitJobs() error {
+	return cli.allowed(opReadPipeline)
+}
+
+// runPipelineTriggerOptions extends gitlab.RunPipelineTriggerOptions with pipeline inputs.
+type runPipelineTriggerOptions struct {
+	Ref       *string                `json:"ref"`
+	Token     *string                `json:"token"`
+	Variables map[string]string      `json:"variables,omitempty"`
+	Inputs    map[string]interface{} `json:"inputs,omitempty"`
+}
+
+// runPipelineTrigger creates a pipeline through the trigger endpoint which
+// accepts both trigger tokens and CI_JOB_TOKEN.
+func (cli *GitlabClient) runPipelineTrigger(pipelineInfo *PipelineInfo, token string) (*int, error) {
+	req, err := cli.NewRequest(
+		http.MethodPost,
+		fmt.Sprintf("projects/%s/trigger/pipeline", pipelineInfo.Project.urlPath()),
+		&runPipelineTriggerOptions{
+			Ref:       gitlab.String(pipelineInfo.Branch),
+			Token:     gitlab.String(token),
+			Variables: pipelineInfo.KeyVals,
+			Inputs:    pipelineInfo.Inputs,
+		},
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline := new(gitlab.Pipeline)
+	if _, err := cli.Do(req, pipeline); err != nil {
+		return nil, err
+	}
+	return &pipeline.ID, nil
+}
@@ -0,0 +1,29 @@
+package gitlab
+
+import "testing"
+
+func TestCanWaitJobs(t *testing.T) {
+	tests := []struct {
+		creds   []*Credentials
+		allowed bool
+	}{
+		{[]*Credentials{{Mode: AuthPersonalToken, Token: "pat"}}, true},
+		{[]*Credentials{{Mode: AuthOAuth, Token: "oauth"}}, true},
+		{[]*Credentials{{Mode: AuthJobToken, Token: "job"}}, false},
+		{[]*Credentials{{Mode: AuthTriggerToken, Token: "trigger"}}, false},
+		{[]*Credentials{{Mode: AuthPersonalToken, Token: "pat"}, {Mode: AuthTriggerToken, Token: "trigger"}}, true},
+	}
+	for _, tt := range tests {
+		cli, err := NewClient("https://gitlab.example.com/api/v4", WithCredentials(tt.creds...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = cli.CanWaitJobs()
+		if (err == nil) != tt.allowed {
+			t.Errorf("%s: CanWaitJobs() = %v, want allowed %t", tt.creds[0].Mode, err, tt.allowed)
+		}
+		if err != nil && !IsAuthError(err) {
+			t.Errorf("%s: %v is not an auth error", tt.creds[0].Mode, err)
+		}
+	}
+}
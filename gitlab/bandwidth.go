@@ -0,0 +1,54 @@
+package gitlab
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// Largest read of an artifact body between two waits of the limiter.
+const bandwidthChunk = 32 << 10
+
+// BandwidthLimiter caps the bytes per second read by all the artifact
+// downloads sharing it, e.g. those of several clients.
+type BandwidthLimiter struct {
+	limiter *rate.Limiter
+}
+
+// NewBandwidthLimiter allows bytesPerSecond bytes per second, the bandwidth
+// is unlimited when it is 0.
+func NewBandwidthLimiter(bytesPerSecond int64) *BandwidthLimiter {
+	if bytesPerSecond <= 0 {
+		return &BandwidthLimiter{limiter: rate.NewLimiter(rate.Inf, bandwidthChunk)}
+	}
+	burst := int64(bandwidthChunk)
+	if bytesPerSecond < burst {
+		burst = bytesPerSecond
+	}
+	return &BandwidthLimiter{limiter: rate.NewLimiter(rate.Limit(bytesPerSecond), int(burst))}
+}
+
+// limitedBody waits for the limiter after every read.
+type limitedBody struct {
+	ctx     context.Context
+	body    io.ReadCloser
+	limiter *rate.Limiter
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if len(p) > b.limiter.Burst() {
+		p = p[:b.limiter.Burst()]
+	}
+	n, err := b.body.Read(p)
+	if n > 0 {
+		if waitErr := b.limiter.WaitN(b.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.body.Close()
+}
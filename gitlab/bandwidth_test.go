@@ -0,0 +1,83 @@
+package gitlab_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab/gitlabtest"
+)
+
+// downloadAll reads the artifact of the build job with every client at once
+// and returns how long it took.
+func downloadAll(t *testing.T, size int, clients int, limiter *gitlab.BandwidthLimiter) time.Duration {
+	t.Helper()
+	srv := gitlabtest.NewServer()
+	defer srv.Close()
+	project := srv.AddProject("group/repo")
+	srv.OnPipelineCreated(func(p *gitlabtest.Pipeline) {
+		p.AddJob("build", "build", gitlabtest.Success).Artifact = make([]byte, size)
+	})
+	cli, err := srv.Client(gitlab.WithBandwidthLimiter(limiter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline := &gitlab.PipelineInfo{Project: &gitlab.Project{ID: project.ID}, Branch: "main"}
+	if pipeline.ID, err = cli.TriggerPipeline(pipeline); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := cli.FindJobs(context.Background(), pipeline, &gitlab.JobsSearch{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		// A client per download, sharing the limiter.
+		cli, err := srv.Client(gitlab.WithBandwidthLimiter(limiter))
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			artifact, err := cli.GetArtifact(context.Background(), pipeline, jobs[0])
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if artifact.Content.Len() != size {
+				t.Errorf("artifact of %d bytes, want %d", artifact.Content.Len(), size)
+			}
+		}()
+	}
+	wg.Wait()
+	return time.Since(start)
+}
+
+func TestBandwidthLimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		clients int
+		limit   int64
+		atLeast time.Duration
+		atMost  time.Duration
+	}{
+		{"unlimited", 2, 0, 0, 200 * time.Millisecond},
+		// The first 32 KiB are the burst, the other 32 KiB take 250ms.
+		{"one download", 1, 128 << 10, 200 * time.Millisecond, 2 * time.Second},
+		// 96 KiB after the burst at 256 KiB/s, shared by both downloads.
+		{"shared", 2, 256 << 10, 300 * time.Millisecond, 2 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			elapsed := downloadAll(t, 64<<10, tt.clients, gitlab.NewBandwidthLimiter(tt.limit))
+			if elapsed < tt.atLeast || elapsed > tt.atMost {
+				t.Errorf("downloaded in %v, want between %v and %v", elapsed, tt.atLeast, tt.atMost)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package gitlab
+
+import (
+	"context"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// BridgeInfo is a trigger job of a pipeline, it starts a downstream pipeline.
+type BridgeInfo struct {
+	ID     int
+	Name   string
+	Stage  string
+	Status string
+	// Zero until the downstream pipeline is created.
+	DownstreamPipeline int
+	DownstreamProject  int
+}
+
+// FindBridges returns the trigger jobs of the pipeline.
+func (cli *GitlabClient) FindBridges(ctx context.Context, pipeline *PipelineInfo) ([]*BridgeInfo, error) {
+	if err := cli.allowed(opReadPipeline); err != nil {
+		return nil, err
+	}
+	listed, err := listAll(
+		cli.frozenContext(ctx, pipeline),
+		func(listOpts gitlab.ListOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Bridge, *gitlab.Response, error) {
+			return cli.Bridges.ListPipelineBridges(
+				pipeline.Project.pid(),
+				*pipeline.ID,
+				&gitlab.ListJobsOptions{ListOptions: listOpts},
+				options...,
+			)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	bridges := make([]*BridgeInfo, 0, len(listed))
+	for _, bridge := range listed {
+		info := &BridgeInfo{
+			ID:     bridge.ID,
+			Name:   bridge.Name,
+			Stage:  bridge.Stage,
+			Status: bridge.Status,
+		}
+		if bridge.DownstreamPipeline != nil {
+			info.DownstreamPipeline = bridge.DownstreamPipeline.ID
+			info.DownstreamProject = bridge.DownstreamPipeline.ProjectID
+		}
+		bridges = append(bridges, info)
+	}
+	return bridges, nil
+}
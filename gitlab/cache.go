@@ -0,0 +1,243 @@
+package gitlab
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// Largest response body kept in a cache. Artifacts and logs are never cached.
+const maxCachedBody = 1 << 20
+
+// CachedResponse is a GET response GitLab sent with an ETag.
+type CachedResponse struct {
+	ETag   string      `json:"etag"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// Cache keeps GET responses to revalidate them with If-None-Match. Keys
+// stand for the URL and the credentials of the request.
+type Cache interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, resp *CachedResponse)
+}
+
+// MemoryCache keeps the responses for the life of the process.
+type MemoryCache struct {
+	mu        sync.Mutex
+	responses map[string]*CachedResponse
+}
+
+// NewMemoryCache returns an empty in-memory cache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{responses: make(map[string]*CachedResponse)}
+}
+
+func (c *MemoryCache) Get(key string) (*CachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resp, ok := c.responses[key]
+	return resp, ok
+}
+
+func (c *MemoryCache) Set(key string, resp *CachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.responses[key] = resp
+}
+
+// DiskCache keeps the responses in files of a directory, readable by the
+// user only, so they outlive the process. Files which cannot be read or
+// written are treated as missing.
+type DiskCache struct {
+	dir    string
+	memory *MemoryCache
+}
+
+// NewDiskCache creates the directory if needed.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir: dir, memory: NewMemoryCache()}, nil
+}
+
+func (c *DiskCache) Get(key string) (*CachedResponse, bool) {
+	if resp, ok := c.memory.Get(key); ok {
+		return resp, true
+	}
+	content, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	resp := new(CachedResponse)
+	if err := json.Unmarshal(content, resp); err != nil {
+		return nil, false
+	}
+	c.memory.Set(key, resp)
+	return resp, true
+}
+
+func (c *DiskCache) Set(key string, resp *CachedResponse) {
+	c.memory.Set(key, resp)
+	content, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	// Written aside and renamed, concurrent runs never read half a file.
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), c.path(key)); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// frozenKey marks the requests whose cached responses are served without
+// asking GitLab, see frozenContext.
+type frozenKey struct{}
+
+// frozenPipeline tells whether the lists of a pipeline do not change
+// anymore. The status is only asked once a list is cached, and once for all
+// its pages.
+type frozenPipeline struct {
+	once   sync.Once
+	frozen bool
+	check  func(ctx context.Context) bool
+}
+
+func (f *frozenPipeline) isFrozen(ctx context.Context) bool {
+	f.once.Do(func() {
+		// The status request itself is not served frozen.
+		f.frozen = f.check(context.WithValue(ctx, frozenKey{}, nil))
+	})
+	return f.frozen
+}
+
+// frozenContext marks the list requests of the pipeline, their cached
+// responses are served as long as the pipeline is finished. The status is
+// asked on every call, a retried pipeline is running again.
+func (cli *GitlabClient) frozenContext(ctx context.Context, pipeline *PipelineInfo) context.Context {
+	if cli.cache == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, frozenKey{}, &frozenPipeline{check: func(ctx context.Context) bool {
+		p, _, err := cli.Pipelines.GetPipeline(pipeline.Project.pid(), *pipeline.ID, gitlab.WithContext(ctx))
+		if err != nil {
+			cli.log.Debug("pipeline status was not read", "pipeline", *pipeline.ID, "error", err)
+			return false
+		}
+		switch p.Status {
+		case Success, Failed, Canceled, Skipped:
+			return true
+		}
+		return false
+	}})
+}
+
+// cacheTransport revalidates GET responses with their ETag, a 304 is
+// answered with the cached response.
+type cacheTransport struct {
+	cache Cache
+	base  http.RoundTripper
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.base.RoundTrip(req)
+	}
+	key := cacheKey(req)
+	cached, ok := t.cache.Get(key)
+	if frozen, _ := req.Context().Value(frozenKey{}).(*frozenPipeline); ok && frozen != nil && frozen.isFrozen(req.Context()) {
+		return cached.response(req), nil
+	}
+	if ok {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if ok && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return cached.response(req), nil
+	}
+	if !cacheable(resp) {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCachedBody+1))
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(body) <= maxCachedBody {
+		t.cache.Set(key, &CachedResponse{ETag: resp.Header.Get("ETag"), Header: resp.Header.Clone(), Body: body})
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// cacheable tells whether the response is a JSON document with an ETag.
+func cacheable(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == "" {
+		return false
+	}
+	if resp.ContentLength > maxCachedBody {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+func (c *CachedResponse) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        c.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(c.Body)),
+		ContentLength: int64(len(c.Body)),
+		Request:       req,
+	}
+}
+
+// cacheKey hashes the URL together with the credentials, responses depend on
+// what the token may see.
+func cacheKey(req *http.Request) string {
+	hash := sha256.New()
+	hash.Write([]byte(req.URL.String()))
+	for _, name := range []string{"Authorization", "Private-Token", "Job-Token"} {
+		hash.Write([]byte{0})
+		hash.Write([]byte(req.Header.Get(name)))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
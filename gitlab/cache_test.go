@@ -0,0 +1,169 @@
+package gitlab
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// etagServer answers GETs with body as contentType and an ETag, and 304
+// when the request carries it.
+type etagServer struct {
+	*httptest.Server
+	requests    atomic.Int32
+	revalidated atomic.Int32
+}
+
+func newETagServer(t *testing.T, contentType string, body []byte) *etagServer {
+	t.Helper()
+	s := &etagServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			s.revalidated.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func get(t *testing.T, transport http.RoundTripper, ctx context.Context, url string) []byte {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestCacheTransport(t *testing.T) {
+	jobs := []byte(`[{"id":1,"name":"build"}]`)
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		revalidated int32
+	}{
+		{"json", "application/json; charset=utf-8", jobs, 1},
+		{"not json", "text/plain", []byte("log"), 0},
+		{"too large", "application/json", bytes.Repeat([]byte(" "), maxCachedBody+1), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newETagServer(t, tt.contentType, tt.body)
+			transport := &cacheTransport{cache: NewMemoryCache(), base: http.DefaultTransport}
+			for i := 0; i < 2; i++ {
+				if body := get(t, transport, context.Background(), srv.URL); !bytes.Equal(body, tt.body) {
+					t.Errorf("request %d read %d bytes, want %d", i, len(body), len(tt.body))
+				}
+			}
+			if n := srv.requests.Load(); n != 2 {
+				t.Errorf("%d requests, want 2", n)
+			}
+			if n := srv.revalidated.Load(); n != tt.revalidated {
+				t.Errorf("%d requests answered 304, want %d", n, tt.revalidated)
+			}
+		})
+	}
+}
+
+func TestCacheTransportFrozen(t *testing.T) {
+	jobs := []byte(`[{"id":1,"name":"build"}]`)
+	for _, finished := range []bool{true, false} {
+		t.Run(map[bool]string{true: "finished", false: "running"}[finished], func(t *testing.T) {
+			srv := newETagServer(t, "application/json", jobs)
+			transport := &cacheTransport{cache: NewMemoryCache(), base: http.DefaultTransport}
+			checks := 0
+			ctx := context.WithValue(context.Background(), frozenKey{}, &frozenPipeline{check: func(ctx context.Context) bool {
+				checks++
+				return finished
+			}})
+
+			// Nothing is cached yet, the status is not needed.
+			get(t, transport, ctx, srv.URL+"?page=1")
+			if checks != 0 {
+				t.Errorf("status checked %d times before a list was cached", checks)
+			}
+			get(t, transport, ctx, srv.URL+"?page=1")
+			get(t, transport, ctx, srv.URL+"?page=1")
+			if checks != 1 {
+				t.Errorf("status checked %d times, want once", checks)
+			}
+			want := int32(3)
+			if finished {
+				want = 1
+			}
+			if n := srv.requests.Load(); n != want {
+				t.Errorf("%d requests, want %d", n, want)
+			}
+		})
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+	cache, err := NewDiskCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &CachedResponse{ETag: `"v1"`, Header: http.Header{"Content-Type": {"application/json"}}, Body: []byte(`{"id":1}`)}
+	cache.Set("key", resp)
+
+	info, err := os.Stat(filepath.Join(dir, "key.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("file mode %v, want 0600", perm)
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Errorf("temporary file %s was left", entry.Name())
+		}
+	}
+
+	// Another run reads the file.
+	reopened, err := NewDiskCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, ok := reopened.Get("key")
+	if !ok || cached.ETag != resp.ETag || !bytes.Equal(cached.Body, resp.Body) || cached.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("cached = %+v, %t, want %+v", cached, ok, resp)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reopened.Get("broken"); ok {
+		t.Error("a broken file was read as a response")
+	}
+	if _, ok := reopened.Get("missing"); ok {
+		t.Error("a missing file was read as a response")
+	}
+}
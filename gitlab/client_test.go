@@ -0,0 +1,327 @@
+package gitlab_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab/gitlabtest"
+)
+
+// newScenario starts a fake server whose pipelines are set up by setup, and
+// a client of it.
+func newScenario(t *testing.T, setup func(*gitlabtest.Pipeline), opts ...gitlab.Option) (*gitlabtest.Server, *gitlab.GitlabClient, *gitlab.PipelineInfo) {
+	t.Helper()
+	srv := gitlabtest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.Token = "secret"
+	project := srv.AddProject("group/repo")
+	srv.OnPipelineCreated(setup)
+	cli, err := srv.Client(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, cli, &gitlab.PipelineInfo{Project: &gitlab.Project{ID: project.ID}, Branch: "main"}
+}
+
+func trigger(t *testing.T, cli *gitlab.GitlabClient, pipeline *gitlab.PipelineInfo) {
+	t.Helper()
+	id, err := cli.TriggerPipeline(pipeline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline.ID = id
+}
+
+func findJob(t *testing.T, cli *gitlab.GitlabClient, pipeline *gitlab.PipelineInfo, name string) *gitlab.JobInfo {
+	t.Helper()
+	jobs, err := cli.FindJobs(context.Background(), pipeline, &gitlab.JobsSearch{Jobs: &[]string{name}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jobs[0]
+}
+
+// count returns how many requests were served with the method on paths
+// matching the suffix.
+func count(srv *gitlabtest.Server, method, suffix string) int {
+	n := 0
+	for _, request := range srv.Requests() {
+		if strings.HasPrefix(request, method+" ") && strings.HasSuffix(request, suffix) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestClientDownloadsArtifacts(t *testing.T) {
+	artifact := bytes.Repeat([]byte("artifact"), 10000)
+	for _, omitTotals := range []bool{false, true} {
+		t.Run(fmt.Sprintf("omit totals=%t", omitTotals), func(t *testing.T) {
+			// The job is on the third page of the job list.
+			srv, cli, pipeline := newScenario(t, func(p *gitlabtest.Pipeline) {
+				for i := 0; i < 250; i++ {
+					p.AddJob(fmt.Sprintf("test-%d", i), "test", gitlabtest.Success)
+				}
+				build := p.AddJob("build", "build", gitlabtest.Pending, gitlabtest.Running, gitlabtest.Success)
+				build.Artifact = artifact
+			})
+			srv.OmitTotals = omitTotals
+			trigger(t, cli, pipeline)
+
+			ctx := context.Background()
+			job := findJob(t, cli, pipeline, "build")
+			if err := cli.WaitJob(ctx, pipeline, job); err != nil {
+				t.Fatal(err)
+			}
+			if job.Status != gitlabtest.Success || job.ArtifactSize != int64(len(artifact)) {
+				t.Errorf("job %s with %d bytes, want success with %d", job.Status, job.ArtifactSize, len(artifact))
+			}
+			downloaded, err := cli.GetArtifact(ctx, pipeline, job)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file, err := cli.DownloadArtifact(downloaded, t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := os.ReadFile(file.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sum := sha256.Sum256(artifact)
+			if !bytes.Equal(content, artifact) || file.SHA256 != hex.EncodeToString(sum[:]) {
+				t.Errorf("downloaded %d bytes with SHA-256 %s, want the artifact", len(content), file.SHA256)
+			}
+			if pages := count(srv, http.MethodGet, "/jobs"); pages != 3 {
+				t.Errorf("%d pages of jobs were read, want 3", pages)
+			}
+		})
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	srv, cli, pipeline := newScenario(t, func(p *gitlabtest.Pipeline) {
+		p.AddJob("build", "build", gitlabtest.Running, gitlabtest.Success).Artifact = []byte("artifact")
+	})
+	srv.Fail(http.MethodPost, "projects/*/pipeline", http.StatusTooManyRequests, 1)
+	srv.Fail(http.MethodGet, "projects/*/pipelines/*/jobs", http.StatusBadGateway, 2)
+	// The second poll of the job fails twice.
+	srv.Inject(gitlabtest.Fault{Method: http.MethodGet, Pattern: "projects/*/jobs/*", Skip: 1, Times: 2, Status: http.StatusServiceUnavailable})
+	srv.Fail(http.MethodGet, "projects/*/jobs/*/artifacts", http.StatusBadGateway, 1)
+
+	trigger(t, cli, pipeline)
+	ctx := context.Background()
+	job := findJob(t, cli, pipeline, "build")
+	artifact, err := cli.WaitJobArtifact(ctx, pipeline, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if artifact.Content.Len() != len("artifact") {
+		t.Errorf("artifact of %d bytes, want %d", artifact.Content.Len(), len("artifact"))
+	}
+
+	if n := len(srv.Pipelines()); n != 1 {
+		t.Errorf("%d pipelines were created, want 1", n)
+	}
+	for _, tt := range []struct {
+		method, suffix string
+		requests       int
+	}{
+		{http.MethodPost, "/pipeline", 2},
+		{http.MethodGet, "/jobs", 3},
+		{http.MethodGet, "/artifacts", 2},
+	} {
+		if n := count(srv, tt.method, tt.suffix); n != tt.requests {
+			t.Errorf("%d %s requests to %s, want %d", n, tt.method, tt.suffix, tt.requests)
+		}
+	}
+	// 2 successful polls with 2 failed ones between them.
+	if polls := srv.Pipeline(*pipeline.ID).Job("build").Polls(); polls != 2 {
+		t.Errorf("the job was polled %d times, want 2", polls)
+	}
+}
+
+func TestClientGivesUp(t *testing.T) {
+	t.Run("pipeline creation after a 502", func(t *testing.T) {
+		srv, cli, pipeline := newScenario(t, func(p *gitlabtest.Pipeline) {})
+		srv.Fail(http.MethodPost, "projects/*/pipeline", http.StatusBadGateway, 1)
+		if _, err := cli.TriggerPipeline(pipeline); err == nil {
+			t.Fatal("the pipeline was created, want the 502")
+		}
+		if n := count(srv, http.MethodPost, "/pipeline"); n != 1 {
+			t.Errorf("%d attempts to create the pipeline, want 1", n)
+		}
+	})
+
+	t.Run("too many retries", func(t *testing.T) {
+		srv, cli, pipeline := newScenario(t, func(p *gitlabtest.Pipeline) {
+			p.AddJob("build", "build", gitlabtest.Success)
+		})
+		trigger(t, cli, pipeline)
+		srv.Fail(http.MethodGet, "projects/*/pipelines/*/jobs", http.StatusBadGateway, 0)
+		if _, err := cli.FindJobs(context.Background(), pipeline, &gitlab.JobsSearch{}, nil); err == nil {
+			t.Fatal("jobs were found, want the 502")
+		}
+		// MaxRetries of the test client is 3.
+		if n := count(srv, http.MethodGet, "/jobs"); n != 4 {
+			t.Errorf("%d attempts to list the jobs, want 4", n)
+		}
+	})
+
+	t.Run("longer wait than allowed", func(t *testing.T) {
+		srv, cli, pipeline := newScenario(t, func(p *gitlabtest.Pipeline) {}, gitlab.WithRetryPolicy(gitlab.RetryPolicy{
+			MaxRetries: 3, WaitMin: time.Millisecond, WaitMax: time.Millisecond, MaxServerWait: 10 * time.Millisecond,
+		}))
+		srv.Inject(gitlabtest.Fault{Method: http.MethodPost, Status: http.StatusTooManyRequests, RetryAfter: time.Minute})
+		start := time.Now()
+		if _, err := cli.TriggerPipeline(pipeline); err == nil {
+			t.Fatal("the pipeline was created, want the 429")
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Errorf("gave up after %v, want right away", elapsed)
+		}
+	})
+}
+
+func TestClientBrokenDownloads(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault *gitlabtest.Fault
+		job   func(*gitlabtest.Job)
+	}{
+		{"truncated", &gitlabtest.Fault{Pattern: "projects/*/jobs/*/artifacts", Truncate: true}, nil},
+		{"broken artifact", nil, func(job *gitlabtest.Job) { job.BrokenArtifact = true }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, cli, pipeline := newScenario(t, func(p *gitlabtest.Pipeline) {
+				build := p.AddJob("build", "build", gitlabtest.Success)
+				build.Artifact = bytes.Repeat([]byte("artifact"), 10000)
+				if tt.job != nil {
+					tt.job(build)
+				}
+			})
+			if tt.fault != nil {
+				srv.Inject(*tt.fault)
+			}
+			trigger(t, cli, pipeline)
+			if _, err := cli.WaitJobArtifact(context.Background(), pipeline, findJob(t, cli, pipeline, "build")); err == nil {
+				t.Error("the artifact was read, want the download to fail")
+			}
+		})
+	}
+}
+
+func TestClientThrottledDownload(t *testing.T) {
+	srv, cli, pipeline := newScenario(t, func(p *gitlabtest.Pipeline) {
+		p.AddJob("build", "build", gitlabtest.Success).Artifact = make([]byte, 32*1024)
+	})
+	// 32 KiB at 128 KiB/s take a quarter of a second.
+	srv.Inject(gitlabtest.Fault{Pattern: "projects/*/jobs/*/artifacts", Rate: 128 * 1024})
+	trigger(t, cli, pipeline)
+	job := findJob(t, cli, pipeline, "build")
+
+	start := time.Now()
+	artifact, err := cli.WaitJobArtifact(context.Background(), pipeline, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("downloaded in %v, want the rate of the fault", elapsed)
+	}
+	if artifact.Content.Len() != 32*1024 {
+		t.Errorf("artifact of %d bytes, want %d", artifact.Content.Len(), 32*1024)
+	}
+}
+
+func TestClientRetriedJob(t *testing.T) {
+	srv, cli, pipeline := newScenario(t, func(p *gitlabtest.Pipeline) {
+		test := p.AddJob("test", "test", gitlabtest.Running, gitlabtest.Failed)
+		test.FailureReason = "runner_system_failure"
+		test.RetryTimeline = []string{gitlabtest.Pending, gitlabtest.Running, gitlabtest.Success}
+		test.Artifact = []byte("report")
+	})
+	trigger(t, cli, pipeline)
+	ctx := context.Background()
+	job := findJob(t, cli, pipeline, "test")
+
+	err := cli.WaitJob(ctx, pipeline, job)
+	var failed *gitlab.JobFailedError
+	if !errors.As(err, &failed) || failed.FailureReason != "runner_system_failure" {
+		t.Fatalf("err = %v, want the job failure", err)
+	}
+	retried, err := cli.RetryJob(pipeline, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried.ID == job.ID || retried.Name != "test" {
+		t.Errorf("retried job %d %s, want a new test job", retried.ID, retried.Name)
+	}
+	artifact, err := cli.WaitJobArtifact(ctx, pipeline, retried)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if artifact.Content.Len() != len("report") {
+		t.Errorf("artifact of %d bytes, want %d", artifact.Content.Len(), len("report"))
+	}
+
+	// The job list only has the retried job, as GitLab's does.
+	jobs, err := cli.FindJobs(ctx, pipeline, &gitlab.JobsSearch{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != retried.ID || jobs[0].Status != gitlabtest.Success {
+		t.Errorf("jobs after the retry: %d, want the successful retried job", len(jobs))
+	}
+	if status := srv.Pipeline(*pipeline.ID).Job("test").Status(); status != gitlabtest.Success {
+		t.Errorf("job status %s, want %s", status, gitlabtest.Success)
+	}
+}
+
+func TestClientCachedJobLists(t *testing.T) {
+	for _, finished := range []bool{true, false} {
+		t.Run(fmt.Sprintf("finished=%t", finished), func(t *testing.T) {
+			status := gitlabtest.Running
+			if finished {
+				status = gitlabtest.Success
+			}
+			srv, cli, pipeline := newScenario(t, func(p *gitlabtest.Pipeline) {
+				for i := 0; i < 150; i++ {
+					p.AddJob(fmt.Sprintf("test-%d", i), "test", status)
+				}
+			}, gitlab.WithCache(gitlab.NewMemoryCache()))
+			trigger(t, cli, pipeline)
+
+			for i := 0; i < 2; i++ {
+				jobs, err := cli.FindJobs(context.Background(), pipeline, &gitlab.JobsSearch{}, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(jobs) != 150 {
+					t.Fatalf("%d jobs, want 150", len(jobs))
+				}
+			}
+			// The status is only asked once the two pages are cached.
+			lists := 4
+			if finished {
+				lists = 2
+			}
+			if n := count(srv, http.MethodGet, "/jobs"); n != lists {
+				t.Errorf("%d job list requests, want %d", n, lists)
+			}
+			if n := count(srv, http.MethodGet, fmt.Sprintf("/pipelines/%d", *pipeline.ID)); n != 1 {
+				t.Errorf("%d pipeline status requests, want 1", n)
+			}
+		})
+	}
+}
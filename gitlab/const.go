@@ -10,4 +10,16 @@ const (
 	Canceled = "canceled"
 	Skipped  = "skipped"
 	Manual   = "manual"
+
+	Preparing          = "preparing"
+	Scheduled          = "scheduled"
+	WaitingForResource = "waiting_for_resource"
+)
+
+const (
+	// Pipeline input types
+	InputString  = "string"
+	InputNumber  = "number"
+	InputBoolean = "boolean"
+	InputArray   = "array"
 )
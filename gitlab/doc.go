@@ -0,0 +1,8 @@
+// Package gitlab triggers GitLab CI pipelines, waits for their jobs and
+// downloads the job artifacts.
+//
+// A client is created with NewClient and configured with options, e.g.
+// WithCredentials, WithRetryPolicy or WithPollInterval. It only calls the
+// GitLab API through the services of API, which unit tests replace with
+// WithAPI. The gitlabtest package fakes a whole GitLab instance instead.
+package gitlab
@@ -0,0 +1,64 @@
+package gitlab
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// Shortest time between two progress reports of a download.
+const progressInterval = 250 * time.Millisecond
+
+// downloadKey marks the artifact downloads, its value is the job.
+type downloadKey struct{}
+
+// downloadTransport throttles the bodies of the artifact downloads and
+// reports how far they are.
+type downloadTransport struct {
+	cli *GitlabClient
+	// Nil when the bandwidth is unlimited.
+	limiter *BandwidthLimiter
+	base    http.RoundTripper
+}
+
+func (t *downloadTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	job, ok := req.Context().Value(downloadKey{}).(*JobInfo)
+	if err != nil || !ok || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	if t.limiter != nil {
+		resp.Body = &limitedBody{ctx: req.Context(), body: resp.Body, limiter: t.limiter.limiter}
+	}
+	total := resp.ContentLength
+	if total < 0 {
+		total = job.ArtifactSize
+	}
+	resp.Body = &progressBody{body: resp.Body, report: func(read int64) {
+		t.cli.downloadProgress(job, read, total)
+	}}
+	return resp, nil
+}
+
+// progressBody reports the bytes read so far, at most every
+// progressInterval and once more at the end.
+type progressBody struct {
+	body     io.ReadCloser
+	report   func(read int64)
+	read     int64
+	reported time.Time
+}
+
+func (b *progressBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.read += int64(n)
+	if err == io.EOF || time.Since(b.reported) >= progressInterval {
+		b.report(b.read)
+		b.reported = time.Now()
+	}
+	return n, err
+}
+
+func (b *progressBody) Close() error {
+	return b.body.Close()
+}
@@ -1,10 +1,115 @@
 package gitlab
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+	"golang.org/x/oauth2"
+)
 
 var (
-	errNoMatchingJobsFound  = errors.New("no matching jobs were found")
-	errNotAllJobsFound      = errors.New("not all needed jobs ere found")
 	errNotSuccessfulJob     = errors.New("not successful job")
 	errUnrecognizeJobStatus = errors.New("unrecognized job status")
+	errNoInputsSpec         = errors.New("CI config does not declare spec:inputs")
+	errInvalidInputs        = errors.New("invalid pipeline inputs")
+	errUnknownAuthMode      = errors.New("unknown auth mode")
+	errNoCredentials        = errors.New("no credentials were provided")
+	errOperationNotAllowed  = errors.New("operation is not allowed")
+	errEmptyProject         = errors.New("project is not specified")
+	errDeviceAuthorization  = errors.New("device authorization failed")
+	errPreflightFailed      = errors.New("preflight checks failed")
+	errInvalidCAFile        = errors.New("invalid CA bundle")
+	errClientCertKey        = errors.New("client certificate needs both a certificate and a key file")
+	errInvalidClientCert    = errors.New("failed to load the client certificate")
+	errInvalidProxy         = errors.New("invalid proxy URL")
 )
+
+// IsAuthError tells whether GitLab rejected the credentials or they cannot be
+// used for the operation.
+func IsAuthError(err error) bool {
+	if errors.Is(err, errOperationNotAllowed) || errors.Is(err, errNoCredentials) {
+		return true
+	}
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		return true
+	}
+	var respErr *gitlab.ErrorResponse
+	if errors.As(err, &respErr) && respErr.Response != nil {
+		status := respErr.Response.StatusCode
+		return status == http.StatusUnauthorized || status == http.StatusForbidden
+	}
+	return false
+}
+
+// Errors matched by errors.Is for the error types below.
+var (
+	ErrJobFailed        = errors.New("job did not succeed")
+	ErrJobsMissing      = errors.New("jobs are missing from the pipeline")
+	ErrArtifactNotFound = errors.New("artifact was not found")
+)
+
+// JobFailedError is returned for a waited job which finished without success.
+type JobFailedError struct {
+	Job           *JobInfo
+	Status        string
+	FailureReason string
+	WebURL        string
+	// End of the job log, nil when it was not read.
+	Trace *JobTrace
+}
+
+func (e *JobFailedError) Error() string {
+	msg := fmt.Sprintf("job %s finished with %s", e.Job.Name, e.Status)
+	if e.FailureReason != "" {
+		msg += fmt.Sprintf(" (%s)", e.FailureReason)
+	}
+	if e.WebURL != "" {
+		msg += ", see " + e.WebURL
+	}
+	return msg
+}
+
+func (e *JobFailedError) Is(target error) bool {
+	return target == ErrJobFailed
+}
+
+// JobsMissingError lists all the searched jobs the pipeline does not have.
+type JobsMissingError struct {
+	Names []string
+}
+
+func (e *JobsMissingError) Error() string {
+	return fmt.Sprintf("jobs were not found in the pipeline: %s", strings.Join(e.Names, ", "))
+}
+
+func (e *JobsMissingError) Is(target error) bool {
+	return target == ErrJobsMissing
+}
+
+// ArtifactNotFoundError is returned for a job without artifacts, or whose
+// artifacts expired.
+type ArtifactNotFoundError struct {
+	Job *JobInfo
+	Err error
+}
+
+func (e *ArtifactNotFoundError) Error() string {
+	return fmt.Sprintf("job %s has no artifacts: %s", e.Job.Name, e.Err.Error())
+}
+
+func (e *ArtifactNotFoundError) Is(target error) bool {
+	return target == ErrArtifactNotFound
+}
+
+func (e *ArtifactNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+func isNotFound(err error) bool {
+	var respErr *gitlab.ErrorResponse
+	return errors.As(err, &respErr) && respErr.Response != nil && respErr.Response.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,131 @@
+package gitlab_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab/gitlabtest"
+	goGitlab "github.com/xanzy/go-gitlab"
+)
+
+// The client triggers a pipeline, waits for its jobs and downloads their
+// artifacts, here from a fake GitLab instance.
+func Example() {
+	srv := gitlabtest.NewServer()
+	defer srv.Close()
+	srv.AddProject("group/project")
+	srv.OnPipelineCreated(func(p *gitlabtest.Pipeline) {
+		build := p.AddJob("build", "build", gitlabtest.Pending, gitlabtest.Running, gitlabtest.Success)
+		build.Artifact = []byte("build output")
+		p.AddJob("lint", "test", gitlabtest.Success)
+	})
+	cli, err := srv.Client()
+	if err != nil {
+		log.Fatal(err)
+	}
+	folder, err := os.MkdirTemp("", "artifacts")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	ctx := context.Background()
+	project, err := cli.ResolveProject("group/project")
+	if err != nil {
+		log.Fatal(err)
+	}
+	pipeline := &gitlab.PipelineInfo{Project: project, Branch: "main"}
+	if pipeline.ID, err = cli.TriggerPipeline(pipeline); err != nil {
+		log.Fatal(err)
+	}
+	jobs, err := cli.FindJobs(ctx, pipeline, &gitlab.JobsSearch{Jobs: &[]string{"build"}}, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, job := range jobs {
+		artifact, err := cli.WaitJobArtifact(ctx, pipeline, job)
+		if err != nil {
+			log.Fatal(err)
+		}
+		file, err := cli.DownloadArtifact(artifact, folder)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s: %d bytes\n", job.Name, file.Size)
+	}
+	// Output:
+	// build: 12 bytes
+}
+
+// fakeJobs replaces the jobs API of the client, the other services keep
+// calling the base URL.
+type fakeJobs struct {
+	gitlab.JobsService
+	jobs []*goGitlab.Job
+}
+
+func (f *fakeJobs) ListPipelineJobs(pid interface{}, id int, opts *goGitlab.ListJobsOptions, _ ...goGitlab.RequestOptionFunc) ([]*goGitlab.Job, *goGitlab.Response, error) {
+	if opts.Page > 1 {
+		return nil, nil, nil
+	}
+	return f.jobs, nil, nil
+}
+
+func ExampleWithAPI() {
+	cli, err := gitlab.NewClient("http://gitlab.invalid", gitlab.WithAPI(gitlab.API{
+		Jobs: &fakeJobs{jobs: []*goGitlab.Job{
+			{ID: 1, Name: "build", Status: "success"},
+			{ID: 2, Name: "test", Status: "running"},
+		}},
+	}))
+	if err != nil {
+		log.Fatal(err)
+	}
+	pipelineID := 1
+	pipeline := &gitlab.PipelineInfo{ID: &pipelineID, Project: &gitlab.Project{ID: 1}}
+	jobs, err := cli.FindJobs(context.Background(), pipeline, &gitlab.JobsSearch{}, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, job := range jobs {
+		fmt.Println(job.Name, job.Status)
+	}
+	// Output:
+	// build success
+	// test running
+}
+
+func ExampleJobFailedError() {
+	srv := gitlabtest.NewServer()
+	defer srv.Close()
+	project := srv.AddProject("group/project")
+	srv.OnPipelineCreated(func(p *gitlabtest.Pipeline) {
+		test := p.AddJob("test", "test", gitlabtest.Running, gitlabtest.Failed)
+		test.FailureReason = "script_failure"
+	})
+	cli, err := srv.Client()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	pipeline := &gitlab.PipelineInfo{Project: &gitlab.Project{ID: project.ID}, Branch: "main"}
+	if pipeline.ID, err = cli.TriggerPipeline(pipeline); err != nil {
+		log.Fatal(err)
+	}
+	jobs, err := cli.FindJobs(ctx, pipeline, &gitlab.JobsSearch{Jobs: &[]string{"test"}}, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = cli.WaitJobArtifact(ctx, pipeline, jobs[0])
+	var failed *gitlab.JobFailedError
+	if errors.As(err, &failed) {
+		fmt.Printf("%s finished with %s: %s\n", failed.Job.Name, failed.Status, failed.FailureReason)
+	}
+	// Output:
+	// test finished with failed: script_failure
+}
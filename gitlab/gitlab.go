@@ -3,61 +3,191 @@ package gitlab
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
 	"os"
 	"sync"
 	"time"
 
+	"github.com/hashicorp/go-cleanhttp"
 	"github.com/xanzy/go-gitlab"
+	"golang.org/x/time/rate"
 )
 
 const (
-	sleepStep        = 10 * time.Second
-	pipelinesPerPage = 20
-	jobsPerPage      = 20
+	defaultPollInterval = 10 * time.Second
 )
 
+// GitlabClient waits for pipeline jobs and downloads their artifacts. It is
+// created by NewClient and safe for concurrent use.
 type GitlabClient struct {
-	*gitlab.Client
+	API
+
+	auth         AuthMode
+	token        string
+	triggerToken string
+	observer     Observer
+	log          *slog.Logger
+	pollInterval time.Duration
+	traceLines   int
+	cache        Cache
 }
 
-func NewClient(token string, baseURL string) (*GitlabClient, error) {
-	client, err := gitlab.NewClient(
-		token,
-		gitlab.WithBaseURL(baseURL))
-	if err != nil {
-		return nil, err
+// NewClient creates a client of the GitLab API at baseURL, e.g.
+// https://gitlab.example.com/api/v4. Credentials are needed unless every
+// service is replaced with WithAPI.
+func NewClient(baseURL string, opts ...Option) (*GitlabClient, error) {
+	o := &options{
+		retry:        DefaultRetryPolicy,
+		log:          discardLogger,
+		pollInterval: defaultPollInterval,
+		traceLines:   defaultTraceLines,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	cli := &GitlabClient{
+		observer:     o.observer,
+		log:          o.log,
+		pollInterval: o.pollInterval,
+		traceLines:   o.traceLines,
+		cache:        o.cache,
+	}
+
+	var base http.RoundTripper = cleanhttp.DefaultPooledTransport()
+	switch {
+	case o.httpClient != nil && o.httpClient.Transport != nil:
+		base = o.httpClient.Transport
+	case o.transport != nil:
+		transport, err := NewTransport(*o.transport)
+		if err != nil {
+			return nil, err
+		}
+		if o.transport.InsecureSkipVerify {
+			cli.log.Warn(InsecureSkipVerifyWarning)
+		}
+		base = transport
+	}
+	if o.limiter == nil {
+		o.limiter = NewRateLimiter(0, 0)
+	}
+	var transport http.RoundTripper = &retryTransport{
+		policy:  o.retry,
+		limiter: o.limiter,
+		base:    &loggingTransport{cli: cli, base: base},
+	}
+	transport = &downloadTransport{cli: cli, limiter: o.bandwidth, base: transport}
+	if o.cache != nil {
+		// Served responses skip the retries and the rate limit.
+		transport = &cacheTransport{cache: o.cache, base: transport}
+	}
+
+	var client *gitlab.Client
+	for _, c := range o.creds {
+		if c.Mode == AuthTriggerToken {
+			cli.triggerToken = c.Token
+			continue
+		}
+		if client != nil {
+			continue
+		}
+		var err error
+		client, err = newAPIClient(baseURL, c, transport)
+		if err != nil {
+			return nil, err
+		}
+		cli.auth, cli.token = c.Mode, c.Token
+	}
+
+	if client == nil {
+		if cli.triggerToken == "" && o.api.empty() {
+			return nil, errNoCredentials
+		}
+		// The trigger endpoint takes the token in the body, no API auth needed.
+		var err error
+		client, err = gitlab.NewClient("", goGitlabOptions(baseURL, transport)...)
+		if err != nil {
+			return nil, err
+		}
+		cli.auth = AuthTriggerToken
+		if cli.triggerToken == "" {
+			cli.auth = AuthPersonalToken
+		}
+	}
+	cli.API = newAPI(client)
+	cli.API.override(o.api)
+	return cli, nil
+}
+
+// goGitlabOptions leaves retries and rate limiting to the transport.
+func goGitlabOptions(baseURL string, transport http.RoundTripper) []gitlab.ClientOptionFunc {
+	return []gitlab.ClientOptionFunc{
+		gitlab.WithBaseURL(baseURL),
+		gitlab.WithHTTPClient(&http.Client{Transport: transport}),
+		gitlab.WithoutRetries(),
+		gitlab.WithCustomLimiter(rate.NewLimiter(rate.Inf, 0)),
 	}
-	return &GitlabClient{client}, err
 }
 
 type PipelineInfo struct {
-	ID         *int
-	Project    string
-	Repository string
-	Branch     string
-	KeyVals    map[string]string
+	ID      *int
+	Project *Project
+	Branch  string
+	KeyVals map[string]string
+	Inputs  map[string]interface{}
 }
 
+// createPipelineOptions extends gitlab.CreatePipelineOptions with pipeline inputs.
+type createPipelineOptions struct {
+	Ref       *string                            `json:"ref"`
+	Variables *[]*gitlab.PipelineVariableOptions `json:"variables,omitempty"`
+	Inputs    map[string]interface{}             `json:"inputs,omitempty"`
+}
+
+// TriggerPipeline creates a pipeline, through the trigger endpoint when the
+// client holds a trigger or job token.
 func (cli *GitlabClient) TriggerPipeline(pipelineInfo *PipelineInfo) (*int, error) {
-	var variables *[]*gitlab.PipelineVariableOptions
+	switch {
+	case cli.triggerToken != "":
+		return cli.runPipelineTrigger(pipelineInfo, cli.triggerToken)
+	case cli.auth == AuthJobToken:
+		return cli.runPipelineTrigger(pipelineInfo, cli.token)
+	}
+	if err := cli.allowed(opCreatePipeline); err != nil {
+		return nil, err
+	}
+
+	variables := make([]*gitlab.PipelineVariableOptions, 0, len(pipelineInfo.KeyVals))
 	for key, value := range pipelineInfo.KeyVals {
-		*variables = append(*variables, &gitlab.PipelineVariableOptions{
-			Key:   &key,
-			Value: &value,
+		variables = append(variables, &gitlab.PipelineVariableOptions{
+			Key:   gitlab.String(key),
+			Value: gitlab.String(value),
 		})
 	}
 
-	pipeline, _, err := cli.Pipelines.CreatePipeline(
-		makeProjectId(pipelineInfo.Project, pipelineInfo.Repository),
-		&gitlab.CreatePipelineOptions{
+	req, err := cli.NewRequest(
+		http.MethodPost,
+		fmt.Sprintf("projects/%s/pipeline", pipelineInfo.Project.urlPath()),
+		&createPipelineOptions{
 			Ref:       gitlab.String(pipelineInfo.Branch),
-			Variables: variables,
+			Variables: &variables,
+			Inputs:    pipelineInfo.Inputs,
 		},
+		nil,
 	)
 	if err != nil {
 		return nil, err
 	}
+
+	pipeline := new(gitlab.Pipeline)
+	if _, err := cli.Do(req, pipeline); err != nil {
+		return nil, err
+	}
 	return &pipeline.ID, nil
 }
 
@@ -67,8 +197,29 @@ type JobsSearch struct {
 }
 
 type JobInfo struct {
-	ID   int
-	Name string
+	ID            int
+	Name          string
+	Stage         string
+	Status        string
+	AllowFailure  bool
+	FailureReason string
+	WebURL        string
+	// Size in bytes of the artifacts archive, 0 until the job finished with
+	// one.
+	ArtifactSize int64
+}
+
+func newJobInfo(job *gitlab.Job) *JobInfo {
+	return &JobInfo{
+		ID:            job.ID,
+		Name:          job.Name,
+		Stage:         job.Stage,
+		Status:        job.Status,
+		AllowFailure:  job.AllowFailure,
+		FailureReason: job.FailureReason,
+		WebURL:        job.WebURL,
+		ArtifactSize:  int64(job.ArtifactsFile.Size),
+	}
 }
 
 type FindJobsOpts struct {
@@ -82,6 +233,11 @@ func (cli *GitlabClient) FindJobs(
 	jobsSearch *JobsSearch,
 	opts *FindJobsOpts,
 ) ([]*JobInfo, error) {
+	if err := cli.allowed(opReadPipeline); err != nil {
+		return nil, err
+	}
+	cancelErr := cli.allowed(opManageJobs)
+
 	neededJobs := make([]*JobInfo, 0)
 
 	chosenJobStates := make([]gitlab.BuildStateValue, 0)
@@ -93,76 +249,71 @@ func (cli *GitlabClient) FindJobs(
 
 	var wg sync.WaitGroup
 
-	currentPage := 1
-	keepSearhing := true
-	for keepSearhing {
-		pipelineJobs, _, err := cli.Jobs.ListPipelineJobs(
-			makeProjectId(pipeline.Project, pipeline.Repository),
-			*pipeline.ID,
-			&gitlab.ListJobsOptions{
-				ListOptions: gitlab.ListOptions{
-					Page:    currentPage,
-					PerPage: jobsPerPage,
-				},
-				Scope: &chosenJobStates,
-			},
-		)
-		if err != nil {
-			return nil, err
-		}
+	pipelineJobs, err := listAll(
+		cli.frozenContext(ctx, pipeline),
+		func(listOpts gitlab.ListOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Job, *gitlab.Response, error) {
+			return cli.Jobs.ListPipelineJobs(
+				pipeline.Project.pid(),
+				*pipeline.ID,
+				&gitlab.ListJobsOptions{ListOptions: listOpts, Scope: &chosenJobStates},
+				options...,
+			)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
 
-		if len(pipelineJobs) == 0 {
-			keepSearhing = false
-		} else {
-			if jobsSearch.Jobs == nil {
-				for _, job := range pipelineJobs {
-					neededJobs = append(neededJobs, &JobInfo{job.ID, job.Name})
-				}
-			} else {
-				for _, job := range pipelineJobs {
-					isNeededJob := false
-					for _, neededJob := range *jobsSearch.Jobs {
-						if job.Name == neededJob {
-							neededJobs = append(neededJobs, &JobInfo{job.ID, job.Name})
-							isNeededJob = true
-							break
-						}
-					}
-					if opts != nil {
-						if !isNeededJob && opts.CancelUnneededJobs {
-							wg.Add(1)
-							go func() {
-								defer wg.Done()
-								_, _, err := cli.Jobs.CancelJob(
-									makeProjectId(pipeline.Project, pipeline.Repository),
-									job.ID,
-								)
-								if err != nil {
-									fmt.Printf("Failed to cancel job %s\n", job.Name)
-									return
-								}
-								fmt.Printf("Job %s was canceled.\n", job.Name)
-							}()
-						}
-						// ...
-					}
-					if isNeededJob && len(neededJobs) == len(*jobsSearch.Jobs) {
-						keepSearhing = false
-					}
-				}
+	for _, job := range pipelineJobs {
+		if jobsSearch.Jobs == nil {
+			neededJobs = append(neededJobs, newJobInfo(job))
+			continue
+		}
+		isNeededJob := false
+		for _, neededJob := range *jobsSearch.Jobs {
+			if job.Name == neededJob {
+				neededJobs = append(neededJobs, newJobInfo(job))
+				isNeededJob = true
+				break
+			}
+		}
+		if opts != nil {
+			if !isNeededJob && opts.CancelUnneededJobs && cancelErr != nil {
+				cli.jobCanceled(newJobInfo(job), cancelErr)
+			} else if !isNeededJob && opts.CancelUnneededJobs {
+				wg.Add(1)
+				go func(job *gitlab.Job) {
+					defer wg.Done()
+					_, _, err := cli.Jobs.CancelJob(
+						pipeline.Project.pid(),
+						job.ID,
+					)
+					jobInfo := newJobInfo(job)
+					jobInfo.Status = Canceled
+					cli.jobCanceled(jobInfo, err)
+				}(job)
 			}
-			currentPage++
+			// ...
 		}
 	}
 
 	wg.Wait()
 
 	if jobsSearch.Jobs != nil {
-		if len(neededJobs) == 0 {
-			return nil, errNoMatchingJobsFound
+		// Names are compared as a set, a name may be searched twice.
+		found := make(map[string]bool, len(neededJobs))
+		for _, job := range neededJobs {
+			found[job.Name] = true
 		}
-		if len(neededJobs) != len(*jobsSearch.Jobs) {
-			return neededJobs, errNotAllJobsFound
+		missing := &JobsMissingError{}
+		for _, name := range *jobsSearch.Jobs {
+			if !found[name] {
+				missing.Names = append(missing.Names, name)
+				found[name] = true
+			}
+		}
+		if len(missing.Names) != 0 {
+			return neededJobs, missing
 		}
 	}
 
@@ -179,54 +330,117 @@ func (cli *GitlabClient) WaitJobArtifact(
 	pipelineInfo *PipelineInfo,
 	jobInfo *JobInfo,
 ) (*Artifact, error) {
-	waitInterval := time.Duration(10) * time.Second
-	ticker := time.NewTicker(waitInterval)
+	if err := cli.WaitJob(ctx, pipelineInfo, jobInfo); err != nil {
+		return nil, err
+	}
+	return cli.GetArtifact(ctx, pipelineInfo, jobInfo)
+}
+
+// WaitJob polls the job until it finishes. An error is returned for a job
+// that did not succeed.
+func (cli *GitlabClient) WaitJob(
+	ctx context.Context,
+	pipelineInfo *PipelineInfo,
+	jobInfo *JobInfo,
+) error {
+	if err := cli.allowed(opReadPipeline); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(cli.pollInterval)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-ticker.C:
 			job, _, err := cli.Jobs.GetJob(
-				makeProjectId(pipelineInfo.Project, pipelineInfo.Repository),
+				pipelineInfo.Project.pid(),
 				jobInfo.ID,
 			)
 			if err != nil {
-				return nil, err
+				return err
+			}
+			if job.Status != jobInfo.Status {
+				jobInfo.Status = job.Status
+				cli.jobStatusChanged(jobInfo)
 			}
 			finished, err := isFinishedJob(job.Status)
+			if errors.Is(err, errNotSuccessfulJob) {
+				jobInfo.FailureReason, jobInfo.WebURL = job.FailureReason, job.WebURL
+				return &JobFailedError{
+					Job:           jobInfo,
+					Status:        job.Status,
+					FailureReason: job.FailureReason,
+					WebURL:        job.WebURL,
+					Trace:         cli.failedJobTrace(pipelineInfo, jobInfo),
+				}
+			}
 			if err != nil {
-				return nil, err
+				return err
 			}
 			if finished {
-				return cli.GetArtifact(pipelineInfo, jobInfo)
+				jobInfo.ArtifactSize = int64(job.ArtifactsFile.Size)
+				return nil
 			}
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		}
 	}
 }
 
+// GetArtifact reads the artifacts archive of the job, throttled by the
+// bandwidth limiter if any. A ProgressObserver is told how far it is.
 func (cli *GitlabClient) GetArtifact(
+	ctx context.Context,
 	pipelineInfo *PipelineInfo,
 	job *JobInfo,
 ) (*Artifact, error) {
-	content, _, err := cli.Jobs.GetJobArtifacts(
-		makeProjectId(pipelineInfo.Project, pipelineInfo.Repository),
+	if err := cli.allowed(opReadArtifacts); err != nil {
+		return nil, err
+	}
+	content, _, err := cli.Artifacts.GetJobArtifacts(
+		pipelineInfo.Project.pid(),
 		job.ID,
+		gitlab.WithContext(context.WithValue(ctx, downloadKey{}, job)),
 	)
+	if isNotFound(err) {
+		return nil, &ArtifactNotFoundError{Job: job, Err: err}
+	}
 	if err != nil {
 		return nil, err
 	}
 	return &Artifact{job.Name, content}, nil
 }
 
+// ArtifactPath returns the file the artifact of the job is downloaded to.
+func ArtifactPath(folder, jobName string) string {
+	return fmt.Sprintf("%s/%s.zip", folder, jobName)
+}
+
+// ArtifactFile describes a downloaded artifact.
+type ArtifactFile struct {
+	Path   string
+	Size   int64
+	SHA256 string
+}
+
 func (cli *GitlabClient) DownloadArtifact(
 	artifact *Artifact,
 	folder string,
-) error {
-	f, err := os.Create(fmt.Sprintf("%s/%s.zip", folder, artifact.Name))
+) (*ArtifactFile, error) {
+	path := ArtifactPath(folder, artifact.Name)
+	f, err := os.Create(path)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := artifact.Content.WriteTo(io.MultiWriter(f, hash))
+	if err != nil {
+		return nil, err
 	}
-	_, err = artifact.Content.WriteTo(f)
-	return err
+	return &ArtifactFile{
+		Path:   path,
+		Size:   size,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
 }
@@ -0,0 +1,70 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// jobsServer lists the jobs of pipeline 1 of project 1 on a single page.
+func jobsServer(t *testing.T, names ...string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v4/projects/1/pipelines/1/jobs" {
+			http.NotFound(w, r)
+			return
+		}
+		jobs := make([]map[string]interface{}, 0, len(names))
+		if page := r.URL.Query().Get("page"); page == "" || page == "1" {
+			for i, name := range names {
+				jobs = append(jobs, map[string]interface{}{"id": i + 1, "name": name, "status": "success"})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(jobs)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFindJobsMissing(t *testing.T) {
+	tests := []struct {
+		name    string
+		search  []string
+		found   int
+		missing []string
+	}{
+		{"all found", []string{"build", "test"}, 2, nil},
+		{"name repeated", []string{"build", "test", "build"}, 2, nil},
+		{"missing", []string{"build", "deploy", "lint"}, 1, []string{"deploy", "lint"}},
+		{"missing repeated", []string{"deploy", "build", "deploy"}, 1, []string{"deploy"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := jobsServer(t, "build", "test", "docs")
+			cli, err := NewClient(srv.URL+"/api/v4", WithCredentials(&Credentials{Mode: AuthPersonalToken, Token: "token"}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			pipelineID := 1
+			pipeline := &PipelineInfo{ID: &pipelineID, Project: &Project{ID: 1}}
+			jobs, err := cli.FindJobs(context.Background(), pipeline, &JobsSearch{Jobs: &tt.search}, nil)
+			if len(jobs) != tt.found {
+				t.Errorf("%d jobs found, want %d", len(jobs), tt.found)
+			}
+			var missing *JobsMissingError
+			switch {
+			case tt.missing == nil && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.missing != nil && !errors.As(err, &missing):
+				t.Errorf("err = %v, want the missing jobs", err)
+			case tt.missing != nil && !reflect.DeepEqual(missing.Names, tt.missing):
+				t.Errorf("missing %v, want %v", missing.Names, tt.missing)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package gitlabtest
+
+import (
+	"bytes"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+)
+
+const faultChunk = 1024
+
+// Fault is injected into the responses to the requests it matches.
+type Fault struct {
+	// Method of the requests, any when empty.
+	Method string
+	// Pattern matched with path.Match against the request path without the
+	// API prefix, e.g. projects/*/jobs/*. Any path when empty.
+	Pattern string
+	// Skip lets the first matching requests through.
+	Skip int
+	// Times the fault is injected, every time when 0.
+	Times int
+
+	// Status answered instead of the response when set.
+	Status int
+	// RetryAfter is sent along with Status, e.g. for 429.
+	RetryAfter time.Duration
+	// Delay is slept before the response.
+	Delay time.Duration
+	// Rate in bytes per second the body is streamed at.
+	Rate int
+	// Truncate cuts the connection halfway through the body.
+	Truncate bool
+
+	seen     int
+	injected int
+}
+
+// Inject adds a fault. Faults are checked in the order they were added and
+// the first matching one is injected.
+func (s *Server) Inject(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// Fail answers the next requests matching method and pattern with status,
+// times times.
+func (s *Server) Fail(method, pattern string, status, times int) {
+	s.Inject(Fault{Method: method, Pattern: pattern, Status: status, Times: times})
+}
+
+// fault returns a copy of the fault to inject into the request, or nil.
+func (s *Server) fault(method, route string) *Fault {
+	for _, f := range s.faults {
+		if f.Method != "" && f.Method != method {
+			continue
+		}
+		if f.Pattern != "" {
+			if ok, _ := path.Match(f.Pattern, route); !ok {
+				continue
+			}
+		}
+		if f.Times != 0 && f.injected == f.Times {
+			continue
+		}
+		f.seen++
+		if f.seen <= f.Skip {
+			continue
+		}
+		f.injected++
+		injected := *f
+		return &injected
+	}
+	return nil
+}
+
+// serveFault answers the request with the fault, next serves it unless the
+// fault replaces the response.
+func serveFault(w http.ResponseWriter, r *http.Request, f *Fault, next http.HandlerFunc) {
+	if f.Delay > 0 {
+		time.Sleep(f.Delay)
+	}
+	if f.Status != 0 {
+		if f.RetryAfter > 0 {
+			seconds := int((f.RetryAfter + time.Second - 1) / time.Second)
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			if f.Status == http.StatusTooManyRequests {
+				// GitLab tells when its rate limit is reset as well.
+				w.Header().Set("RateLimit-Remaining", "0")
+				w.Header().Set("RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Duration(seconds)*time.Second).Unix(), 10))
+			}
+		}
+		writeError(w, f.Status, http.StatusText(f.Status))
+		return
+	}
+	if f.Rate <= 0 && !f.Truncate {
+		next(w, r)
+		return
+	}
+
+	recorded := &recorder{header: make(http.Header), status: http.StatusOK}
+	next(recorded, r)
+	for key, values := range recorded.header {
+		w.Header()[key] = values
+	}
+	body := recorded.body.Bytes()
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(recorded.status)
+	if f.Truncate {
+		body = body[:len(body)/2]
+	}
+
+	flusher, _ := w.(http.Flusher)
+	for sent := 0; sent < len(body); sent += faultChunk {
+		end := sent + faultChunk
+		if end > len(body) {
+			end = len(body)
+		}
+		if _, err := w.Write(body[sent:end]); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if f.Rate > 0 {
+			time.Sleep(time.Duration(end-sent) * time.Second / time.Duration(f.Rate))
+		}
+	}
+	if f.Truncate {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// recorder keeps the response of a handler to replay it with a fault.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header         { return r.header }
+func (r *recorder) WriteHeader(status int)      { r.status = status }
+func (r *recorder) Write(b []byte) (int, error) { return r.body.Write(b) }
@@ -0,0 +1,300 @@
+package gitlabtest
+
+import (
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// Job statuses, as reported by the GitLab API.
+const (
+	Created  = "created"
+	Pending  = "pending"
+	Running  = "running"
+	Success  = "success"
+	Failed   = "failed"
+	Canceled = "canceled"
+	Skipped  = "skipped"
+	Manual   = "manual"
+)
+
+// Project is a project of the fake server. Its fields are set up before the
+// client uses it.
+type Project struct {
+	ID            int
+	Path          string
+	DefaultBranch string
+	// Refs pipelines can be created for. Any ref is accepted when empty.
+	Refs []string
+	// Repository files by path, the same at every ref.
+	Files map[string]string
+	// CI config file, .gitlab-ci.yml when empty.
+	CIConfigPath string
+
+	srv *Server
+}
+
+// AddPipeline adds an existing pipeline on ref to the project.
+func (p *Project) AddPipeline(ref string) *Pipeline {
+	p.srv.mu.Lock()
+	defer p.srv.mu.Unlock()
+	return p.srv.newPipeline(p, ref)
+}
+
+func (p *Project) hasRef(ref string) bool {
+	if len(p.Refs) == 0 || ref == p.DefaultBranch {
+		return true
+	}
+	for _, r := range p.Refs {
+		if r == ref {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Project) api() *gitlab.Project {
+	return &gitlab.Project{
+		ID:                p.ID,
+		Path:              p.Path,
+		PathWithNamespace: p.Path,
+		DefaultBranch:     p.DefaultBranch,
+		CIConfigPath:      p.CIConfigPath,
+	}
+}
+
+// Pipeline is a pipeline of the fake server.
+type Pipeline struct {
+	ID        int
+	Ref       string
+	Variables map[string]string
+	Inputs    map[string]interface{}
+
+	project  *Project
+	jobs     []*Job
+	bridges  []*Bridge
+	canceled bool
+}
+
+// AddJob adds a job going through the statuses of timeline, one status
+// each time the job is polled. The last status stays, a job without a
+// timeline succeeds right away.
+func (p *Pipeline) AddJob(name, stage string, timeline ...string) *Job {
+	p.project.srv.mu.Lock()
+	defer p.project.srv.mu.Unlock()
+	return p.addJob(name, stage, timeline)
+}
+
+func (p *Pipeline) addJob(name, stage string, timeline []string) *Job {
+	job := &Job{
+		ID:       p.project.srv.nextID(),
+		Name:     name,
+		Stage:    stage,
+		Timeline: timeline,
+		pipeline: p,
+	}
+	p.jobs = append(p.jobs, job)
+	p.project.srv.jobs[job.ID] = job
+	return job
+}
+
+// AddBridge adds a trigger job of the pipeline. downstream may be nil.
+func (p *Pipeline) AddBridge(name, stage, status string, downstream *Pipeline) *Bridge {
+	srv := p.project.srv
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	bridge := &Bridge{
+		ID:         srv.nextID(),
+		Name:       name,
+		Stage:      stage,
+		Status:     status,
+		Downstream: downstream,
+	}
+	p.bridges = append(p.bridges, bridge)
+	return bridge
+}
+
+// Jobs returns the jobs of the pipeline, retried ones included.
+func (p *Pipeline) Jobs() []*Job {
+	p.project.srv.mu.Lock()
+	defer p.project.srv.mu.Unlock()
+	return append([]*Job(nil), p.jobs...)
+}
+
+// Job returns the latest job named name, or nil.
+func (p *Pipeline) Job(name string) *Job {
+	p.project.srv.mu.Lock()
+	defer p.project.srv.mu.Unlock()
+	for i := len(p.jobs) - 1; i >= 0; i-- {
+		if p.jobs[i].Name == name {
+			return p.jobs[i]
+		}
+	}
+	return nil
+}
+
+// Project returns the project of the pipeline.
+func (p *Pipeline) Project() *Project {
+	return p.project
+}
+
+// Canceled tells whether the pipeline was canceled.
+func (p *Pipeline) Canceled() bool {
+	p.project.srv.mu.Lock()
+	defer p.project.srv.mu.Unlock()
+	return p.canceled
+}
+
+// status follows the jobs as GitLab does: running until every job finished,
+// then failed when a job which is not allowed to fail did.
+func (p *Pipeline) status() string {
+	if p.canceled {
+		return Canceled
+	}
+	if len(p.jobs) == 0 {
+		return Created
+	}
+	status := Success
+	for _, job := range p.jobs {
+		if job.retried {
+			continue
+		}
+		switch job.status() {
+		case Success, Skipped, Manual:
+		case Failed:
+			if !job.AllowFailure {
+				status = Failed
+			}
+		case Canceled:
+			if status == Success {
+				status = Canceled
+			}
+		default:
+			return Running
+		}
+	}
+	return status
+}
+
+func (p *Pipeline) api() *gitlab.Pipeline {
+	return &gitlab.Pipeline{
+		ID:        p.ID,
+		ProjectID: p.project.ID,
+		Ref:       p.Ref,
+		Status:    p.status(),
+		WebURL:    p.project.srv.URL + "/" + p.project.Path + "/-/pipelines",
+	}
+}
+
+// Job is a job of the fake server. Its fields are set up before the client
+// uses it.
+type Job struct {
+	ID       int
+	Name     string
+	Stage    string
+	Timeline []string
+
+	AllowFailure  bool
+	FailureReason string
+	// Trace is the raw log of the job, runner section markers included.
+	Trace string
+
+	// Artifact is the artifacts archive, the download is a 404 when nil.
+	Artifact []byte
+	// ArtifactDelay is slept between chunks of the download.
+	ArtifactDelay time.Duration
+	// BrokenArtifact cuts the connection in the middle of the download.
+	BrokenArtifact bool
+
+	// RetryTimeline is the timeline of the job created by a retry.
+	RetryTimeline []string
+
+	polls    int
+	canceled bool
+	retried  bool
+	pipeline *Pipeline
+}
+
+// Status returns the current status of the job.
+func (j *Job) Status() string {
+	j.pipeline.project.srv.mu.Lock()
+	defer j.pipeline.project.srv.mu.Unlock()
+	return j.status()
+}
+
+// Polls returns how many times the job was fetched.
+func (j *Job) Polls() int {
+	j.pipeline.project.srv.mu.Lock()
+	defer j.pipeline.project.srv.mu.Unlock()
+	return j.polls
+}
+
+func (j *Job) status() string {
+	switch {
+	case j.canceled:
+		return Canceled
+	case len(j.Timeline) == 0:
+		return Success
+	case j.polls >= len(j.Timeline):
+		return j.Timeline[len(j.Timeline)-1]
+	}
+	return j.Timeline[j.polls]
+}
+
+func (j *Job) finished() bool {
+	switch j.status() {
+	case Success, Failed, Canceled, Skipped:
+		return true
+	}
+	return false
+}
+
+func (j *Job) api() *gitlab.Job {
+	job := &gitlab.Job{
+		ID:           j.ID,
+		Name:         j.Name,
+		Stage:        j.Stage,
+		Status:       j.status(),
+		Ref:          j.pipeline.Ref,
+		AllowFailure: j.AllowFailure,
+		WebURL:       j.pipeline.project.srv.URL + "/" + j.pipeline.project.Path + "/-/jobs/" + itoa(j.ID),
+	}
+	job.Pipeline.ID = j.pipeline.ID
+	job.Pipeline.ProjectID = j.pipeline.project.ID
+	job.Pipeline.Ref = j.pipeline.Ref
+	if job.Status == Failed {
+		job.FailureReason = j.FailureReason
+	}
+	if job.Status == Success && j.Artifact != nil {
+		job.ArtifactsFile.Filename = "artifacts.zip"
+		job.ArtifactsFile.Size = len(j.Artifact)
+	}
+	return job
+}
+
+// Bridge is a trigger job of the fake server.
+type Bridge struct {
+	ID         int
+	Name       string
+	Stage      string
+	Status     string
+	Downstream *Pipeline
+}
+
+func (b *Bridge) api() *gitlab.Bridge {
+	bridge := &gitlab.Bridge{
+		ID:     b.ID,
+		Name:   b.Name,
+		Stage:  b.Stage,
+		Status: b.Status,
+	}
+	if b.Downstream != nil {
+		bridge.DownstreamPipeline = &gitlab.PipelineInfo{
+			ID:        b.Downstream.ID,
+			ProjectID: b.Downstream.project.ID,
+			Ref:       b.Downstream.Ref,
+			Status:    b.Downstream.status(),
+		}
+	}
+	return bridge
+}
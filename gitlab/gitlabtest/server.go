@@ -0,0 +1,579 @@
+package gitlabtest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gad "github.com/Asideron/gitlab-artifacts-downloader/gitlab"
+)
+
+const (
+	apiPrefix      = "/api/v4/"
+	defaultPerPage = 20
+	maxPerPage     = 100
+	artifactChunk  = 32 * 1024
+)
+
+// Server is a fake of the GitLab API endpoints the gitlab package calls.
+// Its state is kept in memory and only changes with the requests it
+// serves, so a scenario plays the same way every time.
+type Server struct {
+	*httptest.Server
+
+	// Token requests have to carry as PRIVATE-TOKEN, JOB-TOKEN or bearer
+	// token. Any token is accepted when empty.
+	Token string
+	// TriggerToken accepted by the trigger endpoint besides Token.
+	TriggerToken string
+	// OmitTotals leaves the X-Total and X-Total-Pages headers out, as GitLab
+	// does for lists of more than 10,000 items.
+	OmitTotals bool
+
+	mu         sync.Mutex
+	lastID     int
+	projects   []*Project
+	pipelines  map[int]*Pipeline
+	jobs       map[int]*Job
+	faults     []*Fault
+	requests   []string
+	onPipeline func(*Pipeline)
+}
+
+// NewServer starts a fake server, it is stopped with Close.
+func NewServer() *Server {
+	s := NewUnstartedServer()
+	s.Start()
+	return s
+}
+
+// NewUnstartedServer returns a fake server which is started with Start,
+// e.g. once its Listener is replaced.
+func NewUnstartedServer() *Server {
+	s := &Server{
+		pipelines: make(map[int]*Pipeline),
+		jobs:      make(map[int]*Job),
+	}
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// APIURL returns the base URL to create clients with.
+func (s *Server) APIURL() string {
+	return s.URL + strings.TrimSuffix(apiPrefix, "/")
+}
+
+// Client returns a client of the server authenticated with Token, polling
+// jobs every millisecond.
+func (s *Server) Client(opts ...gad.Option) (*gad.GitlabClient, error) {
+	opts = append([]gad.Option{
+		gad.WithCredentials(&gad.Credentials{Mode: gad.AuthPersonalToken, Token: s.Token}),
+		gad.WithPollInterval(time.Millisecond),
+		gad.WithRetryPolicy(gad.RetryPolicy{MaxRetries: 3, WaitMin: time.Millisecond, WaitMax: 5 * time.Millisecond}),
+	}, opts...)
+	return gad.NewClient(s.APIURL(), opts...)
+}
+
+// AddProject adds a project given by its full path, e.g. group/repo.
+func (s *Server) AddProject(path string) *Project {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	project := &Project{
+		ID:            s.nextID(),
+		Path:          path,
+		DefaultBranch: "main",
+		Files:         make(map[string]string),
+		srv:           s,
+	}
+	s.projects = append(s.projects, project)
+	return project
+}
+
+// OnPipelineCreated sets up the pipelines created through the API, e.g.
+// with their jobs. It is also used to answer CI lint requests.
+func (s *Server) OnPipelineCreated(fn func(*Pipeline)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onPipeline = fn
+}
+
+// Pipeline returns the pipeline with the ID, or nil.
+func (s *Server) Pipeline(id int) *Pipeline {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pipelines[id]
+}
+
+// Pipelines returns the pipelines by ID.
+func (s *Server) Pipelines() []*Pipeline {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pipelines := make([]*Pipeline, 0, len(s.pipelines))
+	for _, pipeline := range s.pipelines {
+		pipelines = append(pipelines, pipeline)
+	}
+	sort.Slice(pipelines, func(i, j int) bool { return pipelines[i].ID < pipelines[j].ID })
+	return pipelines
+}
+
+// Requests returns the requests served so far, as "METHOD path".
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) nextID() int {
+	s.lastID++
+	return s.lastID
+}
+
+func (s *Server) newPipeline(project *Project, ref string) *Pipeline {
+	pipeline := &Pipeline{ID: s.nextID(), Ref: ref, project: project}
+	s.pipelines[pipeline.ID] = pipeline
+	return pipeline
+}
+
+func (s *Server) project(id string) *Project {
+	for _, p := range s.projects {
+		if strconv.Itoa(p.ID) == id || p.Path == id {
+			return p
+		}
+	}
+	return nil
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if s.Token == "" {
+		return true
+	}
+	return r.Header.Get("PRIVATE-TOKEN") == s.Token ||
+		r.Header.Get("JOB-TOKEN") == s.Token ||
+		r.Header.Get("Authorization") == "Bearer "+s.Token
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	route := strings.TrimPrefix(r.URL.EscapedPath(), apiPrefix)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+route)
+	fault := s.fault(r.Method, route)
+	s.mu.Unlock()
+	next := s.route
+	if r.Method == http.MethodGet && !strings.HasSuffix(route, "/artifacts") && !strings.HasSuffix(route, "/trace") {
+		next = withETag(next)
+	}
+	if fault != nil {
+		serveFault(w, r, fault, next)
+		return
+	}
+	next(w, r)
+}
+
+// withETag tags JSON responses as GitLab does and answers 304 when the
+// request carries the same tag.
+func withETag(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recorded := &recorder{header: make(http.Header), status: http.StatusOK}
+		next(recorded, r)
+		for key, values := range recorded.header {
+			w.Header()[key] = values
+		}
+		if recorded.status == http.StatusOK {
+			sum := sha256.Sum256(recorded.body.Bytes())
+			etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+			w.Header().Set("ETag", etag)
+			if r.Header.Get("If-None-Match") == etag {
+				w.Header().Del("Content-Type")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		w.WriteHeader(recorded.status)
+		_, _ = w.Write(recorded.body.Bytes())
+	}
+}
+
+func (s *Server) route(w http.ResponseWriter, r *http.Request) {
+	route := strings.TrimPrefix(r.URL.EscapedPath(), apiPrefix)
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		if unescaped, err := url.PathUnescape(segment); err == nil {
+			segments[i] = unescaped
+		}
+	}
+
+	// The trigger endpoint takes its token in the body.
+	isTrigger := len(segments) == 4 && segments[0] == "projects" && segments[2] == "trigger"
+	if !isTrigger && !s.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "401 Unauthorized")
+		return
+	}
+
+	if route == "personal_access_tokens/self" && r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"name": "gitlabtest", "scopes": []string{"api"}, "active": true})
+		return
+	}
+	if len(segments) < 2 || segments[0] != "projects" {
+		writeError(w, http.StatusNotFound, "404 Not Found")
+		return
+	}
+
+	s.mu.Lock()
+	project := s.project(segments[1])
+	s.mu.Unlock()
+	if project == nil {
+		writeError(w, http.StatusNotFound, "404 Project Not Found")
+		return
+	}
+	s.serveProject(w, r, project, segments[2:])
+}
+
+func (s *Server) serveProject(w http.ResponseWriter, r *http.Request, project *Project, segments []string) {
+	get, post := r.Method == http.MethodGet, r.Method == http.MethodPost
+	switch {
+	case len(segments) == 0 && get:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		writeJSON(w, http.StatusOK, project.api())
+	case len(segments) == 1 && segments[0] == "pipeline" && post:
+		s.createPipeline(w, r, project, false)
+	case len(segments) == 2 && segments[0] == "trigger" && segments[1] == "pipeline" && post:
+		s.createPipeline(w, r, project, true)
+	case len(segments) == 2 && segments[0] == "ci" && segments[1] == "lint" && post:
+		s.lint(w, r, project)
+	case len(segments) == 3 && segments[0] == "repository" && segments[1] == "commits" && get:
+		s.commit(w, project, segments[2])
+	case len(segments) >= 4 && segments[0] == "repository" && segments[1] == "files" && segments[len(segments)-1] == "raw" && get:
+		s.rawFile(w, project, strings.Join(segments[2:len(segments)-1], "/"))
+	case len(segments) >= 2 && segments[0] == "pipelines":
+		s.servePipeline(w, r, project, segments[1], segments[2:])
+	case len(segments) >= 2 && segments[0] == "jobs":
+		s.serveJob(w, r, project, segments[1], segments[2:])
+	default:
+		writeError(w, http.StatusNotFound, "404 Not Found")
+	}
+}
+
+func (s *Server) servePipeline(w http.ResponseWriter, r *http.Request, project *Project, id string, segments []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pipeline := s.pipelines[atoi(id)]
+	if pipeline == nil || pipeline.project != project {
+		writeError(w, http.StatusNotFound, "404 Not Found")
+		return
+	}
+	action := strings.Join(segments, "/")
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, pipeline.api())
+	case action == "jobs" && r.Method == http.MethodGet:
+		scopes := make(map[string]bool)
+		for _, scope := range r.URL.Query()["scope[]"] {
+			scopes[scope] = true
+		}
+		jobs := make([]interface{}, 0, len(pipeline.jobs))
+		for _, job := range pipeline.jobs {
+			if job.retried && r.URL.Query().Get("include_retried") != "true" {
+				continue
+			}
+			if len(scopes) != 0 && !scopes[job.status()] {
+				continue
+			}
+			jobs = append(jobs, job.api())
+		}
+		s.writePage(w, r, jobs)
+	case action == "bridges" && r.Method == http.MethodGet:
+		bridges := make([]interface{}, 0, len(pipeline.bridges))
+		for _, bridge := range pipeline.bridges {
+			bridges = append(bridges, bridge.api())
+		}
+		s.writePage(w, r, bridges)
+	case action == "cancel" && r.Method == http.MethodPost:
+		pipeline.canceled = true
+		for _, job := range pipeline.jobs {
+			if !job.finished() {
+				job.canceled = true
+			}
+		}
+		writeJSON(w, http.StatusOK, pipeline.api())
+	case action == "retry" && r.Method == http.MethodPost:
+		pipeline.canceled = false
+		for _, job := range append([]*Job(nil), pipeline.jobs...) {
+			if status := job.status(); !job.retried && (status == Failed || status == Canceled) {
+				s.retry(job)
+			}
+		}
+		writeJSON(w, http.StatusOK, pipeline.api())
+	default:
+		writeError(w, http.StatusNotFound, "404 Not Found")
+	}
+}
+
+func (s *Server) serveJob(w http.ResponseWriter, r *http.Request, project *Project, id string, segments []string) {
+	s.mu.Lock()
+	job := s.jobs[atoi(id)]
+	if job == nil || job.pipeline.project != project {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "404 Not Found")
+		return
+	}
+	action := strings.Join(segments, "/")
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		// Each poll moves the job one step along its timeline.
+		response := job.api()
+		job.polls++
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, response)
+	case action == "cancel" && r.Method == http.MethodPost:
+		if !job.finished() {
+			job.canceled = true
+		}
+		response := job.api()
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, response)
+	case action == "retry" && r.Method == http.MethodPost:
+		response := s.retry(job).api()
+		s.mu.Unlock()
+		writeJSON(w, http.StatusCreated, response)
+	case action == "trace" && r.Method == http.MethodGet:
+		trace := job.Trace
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(trace))
+	case action == "artifacts" && r.Method == http.MethodGet:
+		artifact, delay, broken := job.Artifact, job.ArtifactDelay, job.BrokenArtifact
+		s.mu.Unlock()
+		if artifact == nil {
+			writeError(w, http.StatusNotFound, "404 Not Found")
+			return
+		}
+		writeArtifact(w, artifact, delay, broken)
+	default:
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "404 Not Found")
+	}
+}
+
+// retry replaces the job with a new one going through its RetryTimeline.
+func (s *Server) retry(job *Job) *Job {
+	job.retried = true
+	retried := job.pipeline.addJob(job.Name, job.Stage, job.RetryTimeline)
+	retried.AllowFailure = job.AllowFailure
+	retried.FailureReason = job.FailureReason
+	retried.Trace = job.Trace
+	retried.Artifact = job.Artifact
+	return retried
+}
+
+type createPipelineRequest struct {
+	Ref       string                 `json:"ref"`
+	Token     string                 `json:"token"`
+	Variables json.RawMessage        `json:"variables"`
+	Inputs    map[string]interface{} `json:"inputs"`
+}
+
+func (s *Server) createPipeline(w http.ResponseWriter, r *http.Request, project *Project, trigger bool) {
+	var req createPipelineRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if trigger && s.Token != "" && req.Token != s.Token && (s.TriggerToken == "" || req.Token != s.TriggerToken) {
+		writeError(w, http.StatusNotFound, "404 Not Found")
+		return
+	}
+
+	// The pipeline endpoint takes a list of variables, the trigger one a map.
+	variables := make(map[string]string)
+	if trigger {
+		_ = json.Unmarshal(req.Variables, &variables)
+	} else {
+		var list []struct{ Key, Value string }
+		_ = json.Unmarshal(req.Variables, &list)
+		for _, v := range list {
+			variables[v.Key] = v.Value
+		}
+	}
+
+	s.mu.Lock()
+	if !project.hasRef(req.Ref) {
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, "Reference not found")
+		return
+	}
+	pipeline := s.newPipeline(project, req.Ref)
+	pipeline.Variables, pipeline.Inputs = variables, req.Inputs
+	onPipeline := s.onPipeline
+	s.mu.Unlock()
+
+	// The callback sets the pipeline up with the locking methods.
+	if onPipeline != nil {
+		onPipeline(pipeline)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusCreated, pipeline.api())
+}
+
+// lint reports the jobs of a pipeline set up by OnPipelineCreated.
+func (s *Server) lint(w http.ResponseWriter, r *http.Request, project *Project) {
+	var req struct {
+		Ref string `json:"ref"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	s.mu.Lock()
+	onPipeline := s.onPipeline
+	s.mu.Unlock()
+
+	// The jobs are added to a pipeline of a throwaway server.
+	scratch := &Pipeline{Ref: req.Ref, project: &Project{ID: project.ID, Path: project.Path, srv: &Server{jobs: map[int]*Job{}}}}
+	if onPipeline != nil {
+		onPipeline(scratch)
+	}
+	jobs := make([]map[string]interface{}, 0, len(scratch.jobs))
+	for _, job := range scratch.jobs {
+		jobs = append(jobs, map[string]interface{}{
+			"name":          job.Name,
+			"stage":         job.Stage,
+			"when":          "on_success",
+			"allow_failure": job.AllowFailure,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"valid":    true,
+		"errors":   []string{},
+		"warnings": []string{},
+		"jobs":     jobs,
+	})
+}
+
+func (s *Server) commit(w http.ResponseWriter, project *Project, sha string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !project.hasRef(sha) {
+		writeError(w, http.StatusNotFound, "404 Commit Not Found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id": sha, "short_id": sha})
+}
+
+func (s *Server) rawFile(w http.ResponseWriter, project *Project, file string) {
+	s.mu.Lock()
+	content, ok := project.Files[file]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "404 File Not Found")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(content))
+}
+
+// writePage writes the page of items asked for with GitLab's pagination headers.
+func (s *Server) writePage(w http.ResponseWriter, r *http.Request, items []interface{}) {
+	page, perPage := atoi(r.URL.Query().Get("page")), atoi(r.URL.Query().Get("per_page"))
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = defaultPerPage
+	}
+	if perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+	totalPages := (len(items) + perPage - 1) / perPage
+	if totalPages == 0 {
+		totalPages = 1
+	}
+
+	start, end := (page-1)*perPage, page*perPage
+	if start > len(items) {
+		start = len(items)
+	}
+	if end > len(items) {
+		end = len(items)
+	}
+
+	header := w.Header()
+	header.Set("X-Page", itoa(page))
+	header.Set("X-Per-Page", itoa(perPage))
+	if !s.OmitTotals {
+		header.Set("X-Total", itoa(len(items)))
+		header.Set("X-Total-Pages", itoa(totalPages))
+	}
+	if page < totalPages {
+		header.Set("X-Next-Page", itoa(page+1))
+		next := *r.URL
+		query := next.Query()
+		query.Set("page", itoa(page+1))
+		query.Set("per_page", itoa(perPage))
+		next.RawQuery = query.Encode()
+		header.Set("Link", "<"+s.URL+next.RequestURI()+`>; rel="next"`)
+	}
+	if page > 1 {
+		header.Set("X-Prev-Page", itoa(page-1))
+	}
+	writeJSON(w, http.StatusOK, items[start:end])
+}
+
+// writeArtifact streams the artifact in chunks, cutting the connection
+// halfway through when broken.
+func writeArtifact(w http.ResponseWriter, artifact []byte, delay time.Duration, broken bool) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Length", itoa(len(artifact)))
+	w.WriteHeader(http.StatusOK)
+
+	limit := len(artifact)
+	if broken {
+		limit /= 2
+	}
+	flusher, _ := w.(http.Flusher)
+	for sent := 0; sent < limit; sent += artifactChunk {
+		end := sent + artifactChunk
+		if end > limit {
+			end = limit
+		}
+		if _, err := w.Write(artifact[sent:end]); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+	}
+	if broken {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func itoa(n int) string {
+	return strconv.Itoa(n)
+}
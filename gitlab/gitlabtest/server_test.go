@@ -0,0 +1,209 @@
+package gitlabtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// get requests the path of the API with the token, the body is read whole.
+func get(t *testing.T, s *Server, path string, header http.Header) (*http.Response, []byte, error) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, s.APIURL()+"/"+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("PRIVATE-TOKEN", s.Token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return resp, body, err
+}
+
+func newTestServer(t *testing.T) (*Server, *Job) {
+	t.Helper()
+	s := NewServer()
+	t.Cleanup(s.Close)
+	s.Token = "secret"
+	pipeline := s.AddProject("group/repo").AddPipeline("main")
+	job := pipeline.AddJob("build", "build", Running, Success)
+	job.Artifact = []byte(strings.Repeat("artifact", 1000))
+	return s, job
+}
+
+func TestFaultRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		faults []Fault
+		// Paths requested in turn and the statuses they are answered with.
+		paths    []string
+		statuses []int
+	}{
+		{
+			"method",
+			[]Fault{{Method: http.MethodPost, Status: http.StatusBadGateway}},
+			[]string{"projects/1"},
+			[]int{http.StatusOK},
+		},
+		{
+			"pattern",
+			[]Fault{{Pattern: "projects/*/jobs/*", Status: http.StatusBadGateway}},
+			[]string{"projects/1", "projects/1/jobs/3", "projects/1/jobs/3/trace"},
+			[]int{http.StatusOK, http.StatusBadGateway, http.StatusOK},
+		},
+		{
+			"skip and times",
+			[]Fault{{Pattern: "projects/*", Skip: 1, Times: 2, Status: http.StatusServiceUnavailable}},
+			[]string{"projects/1", "projects/1", "projects/1", "projects/1"},
+			[]int{http.StatusOK, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK},
+		},
+		{
+			"every time",
+			[]Fault{{Status: http.StatusInternalServerError}},
+			[]string{"projects/1", "projects/1/jobs/3"},
+			[]int{http.StatusInternalServerError, http.StatusInternalServerError},
+		},
+		{
+			"first matching fault",
+			[]Fault{{Times: 1, Status: http.StatusServiceUnavailable}, {Status: http.StatusBadGateway}},
+			[]string{"projects/1", "projects/1", "projects/1"},
+			[]int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusBadGateway},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			for _, f := range tt.faults {
+				s.Inject(f)
+			}
+			for i, path := range tt.paths {
+				resp, _, err := get(t, s, path, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.StatusCode != tt.statuses[i] {
+					t.Errorf("request %d to %s: status %d, want %d", i, path, resp.StatusCode, tt.statuses[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFaultResponses(t *testing.T) {
+	t.Run("rate limited", func(t *testing.T) {
+		s, _ := newTestServer(t)
+		s.Inject(Fault{Status: http.StatusTooManyRequests, RetryAfter: 1500 * time.Millisecond})
+		resp, _, _ := get(t, s, "projects/1", nil)
+		if resp.Header.Get("Retry-After") != "2" || resp.Header.Get("RateLimit-Remaining") != "0" || resp.Header.Get("RateLimit-Reset") == "" {
+			t.Errorf("headers %v, want a retry after 2 seconds and the rate limit reset", resp.Header)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		s, job := newTestServer(t)
+		s.Inject(Fault{Pattern: "projects/*/jobs/*/artifacts", Truncate: true})
+		resp, body, err := get(t, s, fmt.Sprintf("projects/1/jobs/%d/artifacts", job.ID), nil)
+		if err == nil || resp.ContentLength != int64(len(job.Artifact)) || len(body) >= len(job.Artifact) {
+			t.Errorf("read %d of %d bytes, err %v, want the body cut", len(body), resp.ContentLength, err)
+		}
+	})
+
+	t.Run("delay and rate", func(t *testing.T) {
+		s, job := newTestServer(t)
+		// 8000 bytes at 40000 bytes per second take 200ms, after the delay.
+		s.Inject(Fault{Pattern: "projects/*/jobs/*/artifacts", Delay: 50 * time.Millisecond, Rate: 40000})
+		start := time.Now()
+		_, body, err := get(t, s, fmt.Sprintf("projects/1/jobs/%d/artifacts", job.ID), nil)
+		if err != nil || string(body) != string(job.Artifact) {
+			t.Fatalf("read %d bytes, err %v, want the artifact", len(body), err)
+		}
+		if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+			t.Errorf("served in %v, want the delay and the rate", elapsed)
+		}
+	})
+}
+
+func TestPagination(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	pipeline := s.AddProject("group/repo").AddPipeline("main")
+	for i := 0; i < 45; i++ {
+		pipeline.AddJob(fmt.Sprintf("test-%d", i), "test", Success)
+	}
+	jobsPath := fmt.Sprintf("projects/1/pipelines/%d/jobs", pipeline.ID)
+
+	tests := []struct {
+		query      string
+		omitTotals bool
+		items      int
+		headers    map[string]string
+		next       bool
+	}{
+		{"", false, 20, map[string]string{"X-Page": "1", "X-Per-Page": "20", "X-Total": "45", "X-Total-Pages": "3", "X-Next-Page": "2", "X-Prev-Page": ""}, true},
+		{"?page=3&per_page=20", false, 5, map[string]string{"X-Page": "3", "X-Total-Pages": "3", "X-Next-Page": "", "X-Prev-Page": "2"}, false},
+		{"?per_page=500", false, 45, map[string]string{"X-Per-Page": "100", "X-Total-Pages": "1"}, false},
+		{"?page=2", true, 20, map[string]string{"X-Total": "", "X-Total-Pages": "", "X-Next-Page": "3"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s omit totals=%t", tt.query, tt.omitTotals), func(t *testing.T) {
+			s.OmitTotals = tt.omitTotals
+			resp, body, err := get(t, s, jobsPath+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var items []json.RawMessage
+			if err := json.Unmarshal(body, &items); err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != tt.items {
+				t.Errorf("%d items, want %d", len(items), tt.items)
+			}
+			for key, value := range tt.headers {
+				if got := resp.Header.Get(key); got != value {
+					t.Errorf("%s: %q, want %q", key, got, value)
+				}
+			}
+			if link := resp.Header.Get("Link"); strings.Contains(link, `rel="next"`) != tt.next {
+				t.Errorf("Link: %q, want a next link %t", link, tt.next)
+			}
+		})
+	}
+}
+
+func TestETag(t *testing.T) {
+	s, job := newTestServer(t)
+	jobPath := fmt.Sprintf("projects/1/jobs/%d", job.ID)
+
+	resp, _, _ := get(t, s, "projects/1", nil)
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag on a JSON response")
+	}
+	resp, body, _ := get(t, s, "projects/1", http.Header{"If-None-Match": {etag}})
+	if resp.StatusCode != http.StatusNotModified || len(body) != 0 {
+		t.Errorf("status %d with %d bytes, want a bodyless 304", resp.StatusCode, len(body))
+	}
+
+	// Each poll moves the job along, its tag changes with it.
+	resp, _, _ = get(t, s, jobPath, nil)
+	running := resp.Header.Get("ETag")
+	resp, _, _ = get(t, s, jobPath, http.Header{"If-None-Match": {running}})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == running {
+		t.Errorf("status %d with tag %s, want the finished job with another tag", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+
+	resp, _, _ = get(t, s, jobPath+"/artifacts", nil)
+	if resp.Header.Get("ETag") != "" {
+		t.Error("artifacts are tagged")
+	}
+}
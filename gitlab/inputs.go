@@ -0,0 +1,206 @@
+package gitlab
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultCIConfigPath = ".gitlab-ci.yml"
+
+// InputSpec describes a single entry of the `spec: inputs:` header of a CI config.
+type InputSpec struct {
+	Type        string        `yaml:"type"`
+	Default     interface{}   `yaml:"default"`
+	Description string        `yaml:"description"`
+	Options     []interface{} `yaml:"options"`
+	Regex       string        `yaml:"regex"`
+}
+
+type ciConfigHeader struct {
+	Spec *struct {
+		Inputs map[string]*InputSpec `yaml:"inputs"`
+	} `yaml:"spec"`
+}
+
+// GetInputsSpec reads the project's CI config at the pipeline ref and returns
+// the inputs declared in its spec header.
+func (cli *GitlabClient) GetInputsSpec(pipelineInfo *PipelineInfo) (map[string]*InputSpec, error) {
+	content, err := cli.getCIConfig(pipelineInfo)
+	if err != nil {
+		return nil, err
+	}
+	return parseInputsSpec(content)
+}
+
+// getCIConfig reads the raw CI config file of the project at the pipeline ref.
+func (cli *GitlabClient) getCIConfig(pipelineInfo *PipelineInfo) ([]byte, error) {
+	if err := cli.allowed(opReadProject); err != nil {
+		return nil, err
+	}
+	pid := pipelineInfo.Project.pid()
+	project, _, err := cli.Projects.GetProject(pid, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ref := gitlab.String(pipelineInfo.Branch)
+	configPath := project.CIConfigPath
+	if configPath == "" {
+		configPath = defaultCIConfigPath
+	}
+	// Configs kept in another project are written as `path@group/project`,
+	// read at its default branch, or `path@group/project:ref`.
+	if path, other, ok := strings.Cut(configPath, "@"); ok {
+		configPath, pid, ref = path, other, nil
+		if project, otherRef, ok := strings.Cut(other, ":"); ok {
+			pid, ref = project, gitlab.String(otherRef)
+		}
+	}
+
+	content, _, err := cli.RepositoryFiles.GetRawFile(pid, configPath, &gitlab.GetRawFileOptions{Ref: ref})
+	return content, err
+}
+
+func parseInputsSpec(content []byte) (map[string]*InputSpec, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	var header ciConfigHeader
+	if err := decoder.Decode(&header); err != nil {
+		if err == io.EOF {
+			return nil, errNoInputsSpec
+		}
+		return nil, err
+	}
+	if header.Spec == nil {
+		return nil, errNoInputsSpec
+	}
+
+	spec := header.Spec.Inputs
+	for name, input := range spec {
+		if input == nil {
+			input = &InputSpec{}
+			spec[name] = input
+		}
+		if input.Type == "" {
+			input.Type = InputString
+		}
+	}
+	return spec, nil
+}
+
+// ValidateInputs checks the given inputs against the spec and converts them to
+// the declared types. String values, e.g. the ones coming from command line
+// flags, are parsed according to the input type. All problems are reported at once.
+func ValidateInputs(spec map[string]*InputSpec, inputs map[string]interface{}) (map[string]interface{}, error) {
+	validated := make(map[string]interface{}, len(inputs))
+	problems := make([]string, 0)
+
+	for name, value := range inputs {
+		input, ok := spec[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unknown input %q", name))
+			continue
+		}
+		converted, err := convertInput(input, value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("input %q: %s", name, err.Error()))
+			continue
+		}
+		validated[name] = converted
+	}
+
+	for name, input := range spec {
+		if _, ok := inputs[name]; !ok && input.Default == nil {
+			problems = append(problems, fmt.Sprintf("missing required input %q", name))
+		}
+	}
+
+	if len(problems) != 0 {
+		return nil, fmt.Errorf("%w: %s", errInvalidInputs, strings.Join(problems, "; "))
+	}
+	return validated, nil
+}
+
+func convertInput(input *InputSpec, value interface{}) (interface{}, error) {
+	raw, isString := value.(string)
+
+	var converted interface{}
+	switch input.Type {
+	case InputString:
+		if !isString {
+			return nil, fmt.Errorf("expected a string, got %v", value)
+		}
+		converted = raw
+	case InputNumber:
+		switch v := value.(type) {
+		case int, int64, float64:
+			converted = v
+		case string:
+			number, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return nil, fmt.Errorf("expected a number, got %q", raw)
+			}
+			converted = number
+		default:
+			return nil, fmt.Errorf("expected a number, got %v", value)
+		}
+	case InputBoolean:
+		switch v := value.(type) {
+		case bool:
+			converted = v
+		case string:
+			boolean, err := strconv.ParseBool(raw)
+			if err != nil {
+				return nil, fmt.Errorf("expected a boolean, got %q", raw)
+			}
+			converted = boolean
+		default:
+			return nil, fmt.Errorf("expected a boolean, got %v", value)
+		}
+	case InputArray:
+		switch v := value.(type) {
+		case []interface{}:
+			converted = v
+		case string:
+			var array []interface{}
+			if err := yaml.Unmarshal([]byte(raw), &array); err != nil {
+				return nil, fmt.Errorf("expected an array, got %q", raw)
+			}
+			converted = array
+		default:
+			return nil, fmt.Errorf("expected an array, got %v", value)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported input type %q", input.Type)
+	}
+
+	if len(input.Options) != 0 && !isInputOption(input.Options, converted) {
+		return nil, fmt.Errorf("%v is not one of %v", converted, input.Options)
+	}
+	if input.Regex != "" && input.Type == InputString {
+		re, err := regexp.Compile(strings.TrimSuffix(strings.TrimPrefix(input.Regex, "/"), "/"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex %q in spec", input.Regex)
+		}
+		if !re.MatchString(raw) {
+			return nil, fmt.Errorf("%q does not match %s", raw, input.Regex)
+		}
+	}
+	return converted, nil
+}
+
+func isInputOption(options []interface{}, value interface{}) bool {
+	for _, option := range options {
+		if reflect.DeepEqual(option, value) || fmt.Sprint(option) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
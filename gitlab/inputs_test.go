@@ -0,0 +1,68 @@
+package gitlab
+
+import (
+	"testing"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+type fakeProjects struct {
+	ciConfigPath string
+}
+
+func (f *fakeProjects) GetProject(pid interface{}, _ *gitlab.GetProjectOptions, _ ...gitlab.RequestOptionFunc) (*gitlab.Project, *gitlab.Response, error) {
+	return &gitlab.Project{ID: 1, PathWithNamespace: "group/repo", CIConfigPath: f.ciConfigPath}, nil, nil
+}
+
+// fakeFiles records where the CI config was read from.
+type fakeFiles struct {
+	pid  interface{}
+	file string
+	ref  *string
+}
+
+func (f *fakeFiles) GetRawFile(pid interface{}, fileName string, opt *gitlab.GetRawFileOptions, _ ...gitlab.RequestOptionFunc) ([]byte, *gitlab.Response, error) {
+	f.pid, f.file, f.ref = pid, fileName, opt.Ref
+	return []byte("spec:\n  inputs:\n    env:\n---\njob:\n  script: make\n"), nil, nil
+}
+
+func TestGetInputsSpecConfigLocation(t *testing.T) {
+	tests := []struct {
+		ciConfigPath string
+		pid          interface{}
+		file         string
+		ref          string
+	}{
+		{"", 1, ".gitlab-ci.yml", "main"},
+		{"ci/pipeline.yml", 1, "ci/pipeline.yml", "main"},
+		{"ci.yml@group/ci-templates", "group/ci-templates", "ci.yml", ""},
+		{"ci.yml@group/ci-templates:v2", "group/ci-templates", "ci.yml", "v2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ciConfigPath, func(t *testing.T) {
+			files := &fakeFiles{}
+			cli, err := NewClient("http://gitlab.invalid", WithAPI(API{
+				Projects:        &fakeProjects{ciConfigPath: tt.ciConfigPath},
+				RepositoryFiles: files,
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			pipeline := &PipelineInfo{Project: &Project{ID: 1}, Branch: "main"}
+			spec, err := cli.GetInputsSpec(pipeline)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := spec["env"]; !ok {
+				t.Errorf("spec = %v, want the env input", spec)
+			}
+			ref := ""
+			if files.ref != nil {
+				ref = *files.ref
+			}
+			if files.pid != tt.pid || files.file != tt.file || ref != tt.ref {
+				t.Errorf("read %v %q at %q, want %v %q at %q", files.pid, files.file, ref, tt.pid, tt.file, tt.ref)
+			}
+		})
+	}
+}
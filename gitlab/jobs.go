@@ -0,0 +1,50 @@
+package gitlab
+
+// GetJob returns the job of the pipeline's project by its ID.
+func (cli *GitlabClient) GetJob(pipelineInfo *PipelineInfo, jobID int) (*JobInfo, error) {
+	if err := cli.allowed(opReadPipeline); err != nil {
+		return nil, err
+	}
+	job, _, err := cli.Jobs.GetJob(pipelineInfo.Project.pid(), jobID)
+	if err != nil {
+		return nil, err
+	}
+	return newJobInfo(job), nil
+}
+
+func (cli *GitlabClient) CancelJob(pipelineInfo *PipelineInfo, jobInfo *JobInfo) error {
+	if err := cli.allowed(opManageJobs); err != nil {
+		return err
+	}
+	_, _, err := cli.Jobs.CancelJob(pipelineInfo.Project.pid(), jobInfo.ID)
+	return err
+}
+
+// RetryJob starts the job again and returns the new job.
+func (cli *GitlabClient) RetryJob(pipelineInfo *PipelineInfo, jobInfo *JobInfo) (*JobInfo, error) {
+	if err := cli.allowed(opManageJobs); err != nil {
+		return nil, err
+	}
+	job, _, err := cli.Jobs.RetryJob(pipelineInfo.Project.pid(), jobInfo.ID)
+	if err != nil {
+		return nil, err
+	}
+	return newJobInfo(job), nil
+}
+
+func (cli *GitlabClient) CancelPipeline(pipelineInfo *PipelineInfo) error {
+	if err := cli.allowed(opManageJobs); err != nil {
+		return err
+	}
+	_, _, err := cli.Pipelines.CancelPipelineBuild(pipelineInfo.Project.pid(), *pipelineInfo.ID)
+	return err
+}
+
+// RetryPipeline retries the failed and canceled jobs of the pipeline.
+func (cli *GitlabClient) RetryPipeline(pipelineInfo *PipelineInfo) error {
+	if err := cli.allowed(opManageJobs); err != nil {
+		return err
+	}
+	_, _, err := cli.Pipelines.RetryPipelineBuild(pipelineInfo.Project.pid(), *pipelineInfo.ID)
+	return err
+}
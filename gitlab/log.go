@@ -0,0 +1,55 @@
+package gitlab
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// discardLogger is used without WithLogger, the client writes nothing on its
+// own.
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// loggingTransport logs the requests sent through it with the logger of the
+// client.
+type loggingTransport struct {
+	cli  *GitlabClient
+	base http.RoundTripper
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	started := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	attrs := []any{
+		"method", req.Method,
+		"url", redactURL(req.URL),
+		"duration_ms", time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		t.cli.log.Debug("http request failed", append(attrs, "error", err)...)
+		return resp, err
+	}
+	t.cli.log.Debug("http request", append(attrs, "status", resp.StatusCode)...)
+	return resp, nil
+}
+
+// redactURL hides the query parameters that may hold a token.
+func redactURL(u *url.URL) string {
+	query := u.Query()
+	redacted := false
+	for key := range query {
+		if strings.Contains(strings.ToLower(key), "token") {
+			query.Set(key, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return u.String()
+	}
+	copied := *u
+	copied.RawQuery = query.Encode()
+	return copied.String()
+}
@@ -0,0 +1,150 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// Unit of the polling intervals and expiry of the device flow, shorter in tests.
+var deviceTimeUnit = time.Second
+
+// OAuthConfig returns the OAuth2 endpoints of the GitLab instance serving
+// the API at baseURL.
+func OAuthConfig(baseURL, clientID string, scopes ...string) *oauth2.Config {
+	instanceURL := strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/api/v4")
+	return &oauth2.Config{
+		ClientID: clientID,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   instanceURL + "/oauth/authorize",
+			TokenURL:  instanceURL + "/oauth/token",
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+		Scopes: scopes,
+	}
+}
+
+// DeviceAuthorization is GitLab's answer to a device authorization request.
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+type deviceTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// AuthorizeDevice starts the OAuth2 device authorization flow. The user has to
+// open the verification URI and enter the user code, see WaitDeviceToken. As
+// with the oauth2 package, ctx may carry the HTTP client under
+// oauth2.HTTPClient.
+func AuthorizeDevice(ctx context.Context, config *oauth2.Config) (*DeviceAuthorization, error) {
+	deviceURL := strings.TrimSuffix(config.Endpoint.TokenURL, "/token") + "/authorize_device"
+	form := url.Values{
+		"client_id": {config.ClientID},
+		"scope":     {strings.Join(config.Scopes, " ")},
+	}
+
+	auth := new(DeviceAuthorization)
+	if err := postForm(ctx, deviceURL, form, auth); err != nil {
+		return nil, err
+	}
+	if auth.DeviceCode == "" {
+		return nil, errDeviceAuthorization
+	}
+	if auth.Interval == 0 {
+		auth.Interval = 5
+	}
+	return auth, nil
+}
+
+// WaitDeviceToken polls the token endpoint until the user approves or denies
+// the device, or the device code expires.
+func WaitDeviceToken(ctx context.Context, config *oauth2.Config, auth *DeviceAuthorization) (*oauth2.Token, error) {
+	interval := time.Duration(auth.Interval) * deviceTimeUnit
+	if auth.ExpiresIn != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(auth.ExpiresIn)*deviceTimeUnit)
+		defer cancel()
+	}
+
+	form := url.Values{
+		"client_id":   {config.ClientID},
+		"device_code": {auth.DeviceCode},
+		"grant_type":  {deviceCodeGrantType},
+	}
+	for {
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		token := new(deviceTokenResponse)
+		if err := postForm(ctx, config.Endpoint.TokenURL, form, token); err != nil {
+			return nil, err
+		}
+		switch token.Error {
+		case "":
+			result := &oauth2.Token{
+				AccessToken:  token.AccessToken,
+				TokenType:    token.TokenType,
+				RefreshToken: token.RefreshToken,
+			}
+			// A token without expires_in does not expire, as for the oauth2 package.
+			if token.ExpiresIn != 0 {
+				result.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+			}
+			return result, nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * deviceTimeUnit
+		default:
+			return nil, fmt.Errorf("%w: %s %s", errDeviceAuthorization, token.Error, token.ErrorDescription)
+		}
+	}
+}
+
+// postForm posts the form and decodes the JSON answer. OAuth errors come back
+// with 4xx codes and are decoded as well.
+func postForm(ctx context.Context, target string, form url.Values, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	// Clients are passed along the context as for the oauth2 package.
+	client := http.DefaultClient
+	if c, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok {
+		client = c
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("%w: %s", errDeviceAuthorization, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,147 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// deviceServer is a GitLab instance answering the polls of the device flow
+// in turn, the last answer is kept for the following polls.
+type deviceServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	answers []map[string]interface{}
+	polls   []time.Time
+}
+
+func newDeviceServer(t *testing.T, answers ...map[string]interface{}) *deviceServer {
+	t.Helper()
+	deviceTimeUnit = time.Millisecond
+	t.Cleanup(func() { deviceTimeUnit = time.Second })
+
+	s := &deviceServer{answers: answers}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/authorize_device", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_id") != "client" || r.FormValue("scope") != "api" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(DeviceAuthorization{
+			DeviceCode:      "device",
+			UserCode:        "ABCD-EFGH",
+			VerificationURI: s.URL + "/oauth/device",
+			ExpiresIn:       1000,
+			Interval:        1,
+		})
+	})
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != deviceCodeGrantType || r.FormValue("device_code") != "device" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.polls = append(s.polls, time.Now())
+		answer := s.answers[0]
+		if len(s.answers) > 1 {
+			s.answers = s.answers[1:]
+		}
+		if _, failed := answer["error"]; failed {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		_ = json.NewEncoder(w).Encode(answer)
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *deviceServer) authorize(t *testing.T) *DeviceAuthorization {
+	t.Helper()
+	auth, err := AuthorizeDevice(context.Background(), OAuthConfig(s.URL+"/api/v4", "client", "api"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth
+}
+
+func TestAuthorizeDevice(t *testing.T) {
+	s := newDeviceServer(t)
+	auth := s.authorize(t)
+	if auth.DeviceCode != "device" || auth.UserCode != "ABCD-EFGH" || auth.Interval != 1 {
+		t.Errorf("authorization = %+v", auth)
+	}
+
+	_, err := AuthorizeDevice(context.Background(), OAuthConfig(s.URL, "other"))
+	if !errors.Is(err, errDeviceAuthorization) {
+		t.Errorf("err = %v, want %v", err, errDeviceAuthorization)
+	}
+}
+
+func TestWaitDeviceToken(t *testing.T) {
+	pending := map[string]interface{}{"error": "authorization_pending"}
+	slowDown := map[string]interface{}{"error": "slow_down"}
+	granted := map[string]interface{}{"access_token": "access", "token_type": "Bearer", "refresh_token": "refresh"}
+
+	t.Run("approved", func(t *testing.T) {
+		s := newDeviceServer(t, pending, slowDown, granted)
+		auth := s.authorize(t)
+		token, err := WaitDeviceToken(context.Background(), OAuthConfig(s.URL, "client", "api"), auth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.AccessToken != "access" || token.RefreshToken != "refresh" {
+			t.Errorf("token = %+v", token)
+		}
+		if !token.Expiry.IsZero() {
+			t.Errorf("expiry = %v, want none without expires_in", token.Expiry)
+		}
+		if len(s.polls) != 3 {
+			t.Fatalf("%d polls, want 3", len(s.polls))
+		}
+		// slow_down adds 5 to the interval of 1.
+		if gap := s.polls[2].Sub(s.polls[1]); gap < 6*deviceTimeUnit {
+			t.Errorf("polled again after %v, want at least %v", gap, 6*deviceTimeUnit)
+		}
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		expiring := map[string]interface{}{"access_token": "access", "expires_in": 7200}
+		s := newDeviceServer(t, expiring)
+		auth := s.authorize(t)
+		token, err := WaitDeviceToken(context.Background(), OAuthConfig(s.URL, "client", "api"), auth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if until := time.Until(token.Expiry); until < time.Hour || until > 2*time.Hour {
+			t.Errorf("token expires in %v, want 2h", until)
+		}
+	})
+
+	t.Run("expired_token", func(t *testing.T) {
+		s := newDeviceServer(t, pending, map[string]interface{}{"error": "expired_token", "error_description": "The device code has expired."})
+		auth := s.authorize(t)
+		_, err := WaitDeviceToken(context.Background(), OAuthConfig(s.URL, "client", "api"), auth)
+		if !errors.Is(err, errDeviceAuthorization) {
+			t.Errorf("err = %v, want %v", err, errDeviceAuthorization)
+		}
+	})
+
+	t.Run("device code expires", func(t *testing.T) {
+		s := newDeviceServer(t, pending)
+		auth := s.authorize(t)
+		auth.ExpiresIn = 20
+		_, err := WaitDeviceToken(context.Background(), OAuthConfig(s.URL, "client", "api"), auth)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("err = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package gitlab
+
+// Observer is told about the state changes of the jobs the client works with.
+type Observer interface {
+	JobStatusChanged(job *JobInfo)
+	JobCanceled(job *JobInfo, err error)
+}
+
+// ProgressObserver is an Observer which is also told how many bytes of the
+// artifacts being downloaded were read. The total is 0 when unknown.
+type ProgressObserver interface {
+	Observer
+	DownloadProgress(job *JobInfo, read, total int64)
+}
+
+func (cli *GitlabClient) jobStatusChanged(job *JobInfo) {
+	cli.log.Debug("job status changed", "job", job.Name, "id", job.ID, "status", job.Status)
+	if cli.observer != nil {
+		cli.observer.JobStatusChanged(job)
+	}
+}
+
+func (cli *GitlabClient) jobCanceled(job *JobInfo, err error) {
+	if err != nil {
+		cli.log.Debug("job was not canceled", "job", job.Name, "id", job.ID, "error", err)
+	} else {
+		cli.log.Debug("job canceled", "job", job.Name, "id", job.ID)
+	}
+	if cli.observer != nil {
+		cli.observer.JobCanceled(job, err)
+	}
+}
+
+func (cli *GitlabClient) downloadProgress(job *JobInfo, read, total int64) {
+	if observer, ok := cli.observer.(ProgressObserver); ok {
+		observer.DownloadProgress(job, read, total)
+	}
+}
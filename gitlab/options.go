@@ -0,0 +1,123 @@
+package gitlab
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Option configures the client created by NewClient.
+type Option func(*options)
+
+type options struct {
+	creds        []*Credentials
+	httpClient   *http.Client
+	transport    *TransportConfig
+	retry        RetryPolicy
+	limiter      *RateLimiter
+	bandwidth    *BandwidthLimiter
+	cache        Cache
+	api          API
+	observer     Observer
+	log          *slog.Logger
+	pollInterval time.Duration
+	traceLines   int
+}
+
+// WithCredentials adds tokens. The first one which is not a trigger token
+// authenticates the API calls, a trigger token is only used to trigger
+// pipelines.
+func WithCredentials(creds ...*Credentials) Option {
+	return func(o *options) {
+		o.creds = append(o.creds, creds...)
+	}
+}
+
+// WithHTTPClient sets the client whose transport sends the requests.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = httpClient
+	}
+}
+
+// WithTransportConfig sets up the TLS, proxy and socket of the connections
+// to GitLab, see TransportConfig. It is ignored when WithHTTPClient sets a
+// transport.
+func WithTransportConfig(cfg TransportConfig) Option {
+	return func(o *options) {
+		o.transport = &cfg
+	}
+}
+
+// WithRetryPolicy sets how failed requests are retried, see RetryPolicy.
+func WithRetryPolicy(retry RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = retry
+	}
+}
+
+// WithRateLimiter sets the limiter of the requests, which may be shared by
+// several clients. By default the rate is unlimited and requests only hold
+// back when GitLab tells its rate limit is exhausted.
+func WithRateLimiter(limiter *RateLimiter) Option {
+	return func(o *options) {
+		o.limiter = limiter
+	}
+}
+
+// WithBandwidthLimiter caps the bytes per second of the artifact downloads,
+// the limiter may be shared by several clients. The bandwidth is unlimited
+// by default.
+func WithBandwidthLimiter(limiter *BandwidthLimiter) Option {
+	return func(o *options) {
+		o.bandwidth = limiter
+	}
+}
+
+// WithCache keeps the GET responses GitLab sends with an ETag in the cache
+// and revalidates them, the list of the jobs of a finished pipeline is then
+// served from it without asking GitLab. Nothing is cached without it.
+func WithCache(cache Cache) Option {
+	return func(o *options) {
+		o.cache = cache
+	}
+}
+
+// WithAPI replaces the services which are set in api, e.g. with fakes in
+// tests. Without credentials the client is then allowed every operation.
+func WithAPI(api API) Option {
+	return func(o *options) {
+		o.api = api
+	}
+}
+
+// WithObserver sets the observer of the job changes, they are only logged
+// without one.
+func WithObserver(observer Observer) Option {
+	return func(o *options) {
+		o.observer = observer
+	}
+}
+
+// WithLogger sets the logger, HTTP requests are logged at the debug level.
+// The client writes nothing without one.
+func WithLogger(log *slog.Logger) Option {
+	return func(o *options) {
+		o.log = log
+	}
+}
+
+// WithPollInterval sets how often waited jobs are checked.
+func WithPollInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.pollInterval = interval
+	}
+}
+
+// WithTraceLines sets how many lines of the log of a failed job are attached
+// to its JobFailedError, no log is fetched when n is 0.
+func WithTraceLines(n int) Option {
+	return func(o *options) {
+		o.traceLines = n
+	}
+}
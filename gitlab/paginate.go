@@ -0,0 +1,143 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/xanzy/go-gitlab"
+)
+
+const (
+	// Largest page GitLab serves.
+	perPage = 100
+	// Pages fetched at once once the number of pages is known.
+	parallelPages = 4
+)
+
+// listFunc fetches one page of a list.
+type listFunc[T any] func(opts gitlab.ListOptions, options ...gitlab.RequestOptionFunc) ([]T, *gitlab.Response, error)
+
+// listAll returns every item of a list, in order. The first page tells how
+// many pages there are and the others are then fetched in parallel. When
+// GitLab does not count them, past 10,000 items, the next links are followed
+// one by one instead.
+func listAll[T any](ctx context.Context, list listFunc[T]) ([]T, error) {
+	items, resp, err := list(gitlab.ListOptions{Page: 1, PerPage: perPage}, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp == nil:
+		return items, nil
+	case resp.TotalPages > 1:
+		rest, err := listPages(ctx, list, resp.TotalPages)
+		if err != nil {
+			return nil, err
+		}
+		return append(items, rest...), nil
+	}
+
+	for {
+		next := nextLink(resp)
+		if next == nil {
+			return items, nil
+		}
+		var page []T
+		page, resp, err = list(gitlab.ListOptions{}, gitlab.WithContext(ctx), withQuery(next.Query()))
+		if err != nil {
+			return nil, err
+		}
+		if len(page) == 0 || resp == nil {
+			return items, nil
+		}
+		items = append(items, page...)
+	}
+}
+
+// listPages fetches the pages 2 to total in parallel.
+func listPages[T any](ctx context.Context, list listFunc[T], total int) ([]T, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pages := make([][]T, total+1)
+	errs := make([]error, total+1)
+	sem := make(chan struct{}, parallelPages)
+	var wg sync.WaitGroup
+	for page := 2; page <= total; page++ {
+		wg.Add(1)
+		go func(page int) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				errs[page] = ctx.Err()
+				return
+			}
+			defer func() { <-sem }()
+			pages[page], _, errs[page] = list(gitlab.ListOptions{Page: page, PerPage: perPage}, gitlab.WithContext(ctx))
+			if errs[page] != nil {
+				cancel()
+			}
+		}(page)
+	}
+	wg.Wait()
+
+	items := make([]T, 0, (total-1)*perPage)
+	for page := 2; page <= total; page++ {
+		if errs[page] != nil {
+			return nil, firstError(errs)
+		}
+		items = append(items, pages[page]...)
+	}
+	return items, nil
+}
+
+// firstError prefers the error a request failed with over the cancellation
+// of the others.
+func firstError(errs []error) error {
+	var canceled error
+	for _, err := range errs {
+		switch {
+		case err == nil:
+		case errors.Is(err, context.Canceled):
+			canceled = err
+		default:
+			return err
+		}
+	}
+	return canceled
+}
+
+// nextLink returns the URL of the next page from the Link header, or nil.
+func nextLink(resp *gitlab.Response) *url.URL {
+	for _, link := range strings.Split(resp.Header.Get("Link"), ",") {
+		parts := strings.Split(link, ";")
+		if len(parts) < 2 {
+			continue
+		}
+		for _, param := range parts[1:] {
+			if strings.TrimSpace(param) != `rel="next"` {
+				continue
+			}
+			next, err := url.Parse(strings.Trim(strings.TrimSpace(parts[0]), "<>"))
+			if err != nil {
+				return nil
+			}
+			return next
+		}
+	}
+	return nil
+}
+
+// withQuery replaces the query of the request, e.g. with the cursor of a
+// next link.
+func withQuery(query url.Values) gitlab.RequestOptionFunc {
+	return func(req *retryablehttp.Request) error {
+		req.URL.RawQuery = query.Encode()
+		return nil
+	}
+}
@@ -0,0 +1,90 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/xanzy/go-gitlab"
+)
+
+// pagedList serves items 1 to count per pages of perPage, with the totals
+// or with next links only.
+func pagedList(count int, counted bool) listFunc[int] {
+	return func(opts gitlab.ListOptions, options ...gitlab.RequestOptionFunc) ([]int, *gitlab.Response, error) {
+		req, err := retryablehttp.NewRequest(http.MethodGet, "https://gitlab.example.com/api/v4/jobs", nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		q := req.URL.Query()
+		q.Set("page", strconv.Itoa(opts.Page))
+		req.URL.RawQuery = q.Encode()
+		for _, option := range options {
+			if err := option(req); err != nil {
+				return nil, nil, err
+			}
+		}
+		page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+
+		items := make([]int, 0, perPage)
+		for i := (page-1)*perPage + 1; i <= count && i <= page*perPage; i++ {
+			items = append(items, i)
+		}
+		pages := (count + perPage - 1) / perPage
+		resp := &gitlab.Response{Response: &http.Response{Header: make(http.Header)}}
+		if counted {
+			resp.TotalPages = pages
+		}
+		if page < pages {
+			resp.Header.Set("Link", fmt.Sprintf(`<https://gitlab.example.com/api/v4/jobs?page=%d>; rel="next"`, page+1))
+		}
+		return items, resp, nil
+	}
+}
+
+func TestListAll(t *testing.T) {
+	for _, counted := range []bool{true, false} {
+		t.Run(fmt.Sprintf("counted=%t", counted), func(t *testing.T) {
+			items, err := listAll(context.Background(), pagedList(350, counted))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != 350 {
+				t.Fatalf("got %d items, want 350", len(items))
+			}
+			for i, item := range items {
+				if item != i+1 {
+					t.Fatalf("item %d is %d, items are out of order", i, item)
+				}
+			}
+		})
+	}
+}
+
+func TestListAllReportsTheFailedPage(t *testing.T) {
+	failure := errors.New("page 3 failed")
+	list := func(opts gitlab.ListOptions, options ...gitlab.RequestOptionFunc) ([]int, *gitlab.Response, error) {
+		if opts.Page == 1 {
+			return []int{1}, &gitlab.Response{Response: &http.Response{Header: make(http.Header)}, TotalPages: parallelPages + 1}, nil
+		}
+		if opts.Page == 3 {
+			return nil, nil, failure
+		}
+		// The other pages, all fetched at once with page 3, wait for the
+		// failure to cancel them, as an HTTP client does.
+		req, _ := retryablehttp.NewRequest(http.MethodGet, "https://gitlab.example.com", nil)
+		for _, option := range options {
+			_ = option(req)
+		}
+		<-req.Context().Done()
+		return nil, nil, &url.Error{Op: "Get", URL: req.URL.String(), Err: req.Context().Err()}
+	}
+	if _, err := listAll(context.Background(), list); err != failure {
+		t.Errorf("err = %v, want %v", err, failure)
+	}
+}
@@ -0,0 +1,278 @@
+package gitlab
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+	"gopkg.in/yaml.v3"
+)
+
+const requiredScope = "api"
+
+// PreflightReport collects everything found wrong before a pipeline is triggered.
+type PreflightReport struct {
+	Problems []string
+	Warnings []string
+	// Jobs the pipeline would create as predicted by the CI lint.
+	Jobs []*LintJob
+}
+
+func (r *PreflightReport) problem(format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+func (r *PreflightReport) warning(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Err returns all the problems as a single error, or nil.
+func (r *PreflightReport) Err() error {
+	if len(r.Problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w:\n  - %s", errPreflightFailed, strings.Join(r.Problems, "\n  - "))
+}
+
+// LintJob is a job of the pipeline simulated by the CI lint.
+type LintJob struct {
+	Name         string `json:"name"`
+	Stage        string `json:"stage"`
+	When         string `json:"when"`
+	AllowFailure bool   `json:"allow_failure"`
+}
+
+type projectLintOptions struct {
+	Content     string `json:"content"`
+	DryRun      bool   `json:"dry_run"`
+	IncludeJobs bool   `json:"include_jobs"`
+	Ref         string `json:"ref,omitempty"`
+}
+
+type projectLintResult struct {
+	Valid    bool       `json:"valid"`
+	Errors   []string   `json:"errors"`
+	Warnings []string   `json:"warnings"`
+	Jobs     []*LintJob `json:"jobs"`
+}
+
+// Preflight checks that the project and the ref exist, that the token has
+// the api scope, and that the pipeline would create at least atLeast of the
+// jobs, every one of them when atLeast is 0. Jobs which would not be created
+// are only warnings while enough of the others would be. It does not stop at
+// the first problem, all of them end up in the report.
+func (cli *GitlabClient) Preflight(pipelineInfo *PipelineInfo, jobs []string, atLeast int) *PreflightReport {
+	report := &PreflightReport{}
+	if err := cli.allowed(opReadProject); err != nil {
+		report.warning("preflight checks were skipped: %s", err.Error())
+		return report
+	}
+
+	pid := pipelineInfo.Project.pid()
+	if _, _, err := cli.Projects.GetProject(pid, nil); err != nil {
+		report.problem("project %s: %s", pipelineInfo.Project, err.Error())
+		return report
+	}
+	if _, _, err := cli.Commits.GetCommit(pid, pipelineInfo.Branch); err != nil {
+		report.problem("ref %q: %s", pipelineInfo.Branch, err.Error())
+	}
+	cli.checkTokenScope(report)
+
+	if len(report.Problems) == 0 {
+		cli.lintPipeline(pipelineInfo, jobs, atLeast, report)
+	}
+	return report
+}
+
+// checkTokenScope only applies to personal access tokens, the other
+// credentials have no self endpoint.
+func (cli *GitlabClient) checkTokenScope(report *PreflightReport) {
+	if cli.auth != AuthPersonalToken {
+		return
+	}
+	req, err := cli.NewRequest(http.MethodGet, "personal_access_tokens/self", nil, nil)
+	if err != nil {
+		report.problem("token: %s", err.Error())
+		return
+	}
+	token := new(gitlab.PersonalAccessToken)
+	resp, err := cli.Do(req, token)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			report.warning("token scopes cannot be checked on this GitLab version")
+			return
+		}
+		report.problem("token: %s", err.Error())
+		return
+	}
+
+	if !token.Active || token.Revoked {
+		report.problem("token %q is not active", token.Name)
+	}
+	if token.ExpiresAt != nil && time.Time(*token.ExpiresAt).Before(time.Now()) {
+		report.problem("token %q has expired", token.Name)
+	}
+	for _, scope := range token.Scopes {
+		if scope == requiredScope {
+			return
+		}
+	}
+	report.problem("token %q lacks the %q scope, it has %v", token.Name, requiredScope, token.Scopes)
+}
+
+// lintPipeline simulates the pipeline creation at the ref and checks enough
+// of the requested jobs are among the created ones.
+func (cli *GitlabClient) lintPipeline(pipelineInfo *PipelineInfo, jobs []string, atLeast int, report *PreflightReport) {
+	config, err := cli.getCIConfig(pipelineInfo)
+	if err != nil {
+		report.problem("CI config: %s", err.Error())
+		return
+	}
+	content, err := lintContent(config, pipelineInfo.KeyVals, pipelineInfo.Inputs)
+	if err != nil {
+		report.problem("CI config: %s", err.Error())
+		return
+	}
+
+	req, err := cli.NewRequest(
+		http.MethodPost,
+		fmt.Sprintf("projects/%s/ci/lint", pipelineInfo.Project.urlPath()),
+		&projectLintOptions{
+			Content:     string(content),
+			DryRun:      true,
+			IncludeJobs: true,
+			Ref:         pipelineInfo.Branch,
+		},
+		nil,
+	)
+	if err != nil {
+		report.problem("CI lint: %s", err.Error())
+		return
+	}
+	result := new(projectLintResult)
+	if _, err := cli.Do(req, result); err != nil {
+		report.problem("CI lint: %s", err.Error())
+		return
+	}
+
+	for _, warning := range result.Warnings {
+		report.warning("CI lint: %s", warning)
+	}
+	if !result.Valid {
+		for _, lintErr := range result.Errors {
+			report.problem("CI lint: %s", lintErr)
+		}
+		return
+	}
+
+	report.Jobs = result.Jobs
+	created := make(map[string]bool, len(result.Jobs))
+	for _, job := range result.Jobs {
+		created[job.Name] = true
+	}
+	missing := make([]string, 0)
+	for _, job := range jobs {
+		if !created[job] {
+			missing = append(missing, job)
+		}
+	}
+	if atLeast == 0 {
+		for _, job := range missing {
+			report.problem("job %q would not be created by the pipeline", job)
+		}
+		return
+	}
+	if len(jobs)-len(missing) < atLeast {
+		report.problem("only %d of the jobs would be created by the pipeline, %d are needed, missing: %s",
+			len(jobs)-len(missing), atLeast, strings.Join(missing, ", "))
+		return
+	}
+	for _, job := range missing {
+		report.warning("job %q would not be created by the pipeline", job)
+	}
+}
+
+// lintContent returns the CI config with the pipeline variables added to the
+// top level variables and the inputs set as the spec defaults. The lint API
+// takes neither, this way rules are evaluated as in the triggered pipeline.
+func lintContent(content []byte, variables map[string]string, inputs map[string]interface{}) ([]byte, error) {
+	if len(variables) == 0 && len(inputs) == 0 {
+		return content, nil
+	}
+
+	docs := make([]*yaml.Node, 0, 2)
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		doc := new(yaml.Node)
+		err := decoder.Decode(doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Empty documents, e.g. after a trailing separator, hold nothing to
+		// set and are not the config.
+		if len(doc.Content) == 0 || doc.Content[0].Tag == "!!null" {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	if len(docs) == 0 {
+		return content, nil
+	}
+
+	// With a spec header the config is the second document.
+	config := docs[len(docs)-1]
+	if len(docs) > 1 {
+		specInputs := mappingValue(mappingValue(docs[0].Content[0], "spec"), "inputs")
+		for name, value := range inputs {
+			if err := mappingValue(mappingValue(specInputs, name), "default").Encode(value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	configVariables := mappingValue(config.Content[0], "variables")
+	for name, value := range variables {
+		if err := mappingValue(configVariables, name).Encode(value); err != nil {
+			return nil, err
+		}
+	}
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	for _, doc := range docs {
+		if err := encoder.Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// mappingValue returns the value node of the key, adding an empty mapping
+// for a missing key or a null value.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping.Kind != yaml.MappingNode {
+		*mapping = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			value := mapping.Content[i+1]
+			if value.Kind == yaml.ScalarNode && value.Tag == "!!null" {
+				*value = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			}
+			return value
+		}
+	}
+	value := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+	return value
+}
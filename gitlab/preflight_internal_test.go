@@ -0,0 +1,72 @@
+package gitlab
+
+import (
+	"bytes"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLintContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"config", "job:\n  script: make\n"},
+		{"spec header", "spec:\n  inputs:\n    env:\n---\njob:\n  script: make\n"},
+		{"leading separator", "---\nspec:\n  inputs:\n    env:\n---\njob:\n  script: make\n"},
+		{"empty documents", "---\n---\nspec:\n  inputs:\n    env:\n---\n---\njob:\n  script: make\n"},
+		{"trailing separator", "job:\n  script: make\n---\n"},
+		{"comment document", "job:\n  script: make\n---\n# generated\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			linted, err := lintContent([]byte(tt.content), map[string]string{"DEPLOY": "yes"}, map[string]interface{}{"env": "prod"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var config struct {
+				Variables map[string]string `yaml:"variables"`
+				Job       struct {
+					Script string `yaml:"script"`
+				} `yaml:"job"`
+			}
+			docs := decodeDocuments(t, linted)
+			if err := docs[len(docs)-1].Decode(&config); err != nil {
+				t.Fatal(err)
+			}
+			if config.Job.Script != "make" || config.Variables["DEPLOY"] != "yes" {
+				t.Errorf("linted config %q misses the job or the variable", linted)
+			}
+			if len(docs) == 2 {
+				var header struct {
+					Spec struct {
+						Inputs map[string]struct {
+							Default string `yaml:"default"`
+						} `yaml:"inputs"`
+					} `yaml:"spec"`
+				}
+				if err := docs[0].Decode(&header); err != nil {
+					t.Fatal(err)
+				}
+				if header.Spec.Inputs["env"].Default != "prod" {
+					t.Errorf("linted config %q misses the input default", linted)
+				}
+			}
+		})
+	}
+}
+
+func decodeDocuments(t *testing.T, content []byte) []*yaml.Node {
+	t.Helper()
+	var docs []*yaml.Node
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		doc := new(yaml.Node)
+		if err := decoder.Decode(doc); err != nil {
+			break
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
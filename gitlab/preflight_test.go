@@ -0,0 +1,51 @@
+package gitlab_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab"
+	"github.com/Asideron/gitlab-artifacts-downloader/gitlab/gitlabtest"
+)
+
+func TestPreflightJobsNeeded(t *testing.T) {
+	srv := gitlabtest.NewServer()
+	defer srv.Close()
+	srv.Token = "secret"
+	project := srv.AddProject("group/repo")
+	project.Files[".gitlab-ci.yml"] = "build:\n  script: make\n"
+	srv.OnPipelineCreated(func(p *gitlabtest.Pipeline) {
+		p.AddJob("build", "build", gitlabtest.Success)
+	})
+	cli, err := srv.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline := &gitlab.PipelineInfo{Project: &gitlab.Project{ID: project.ID}, Branch: "main"}
+
+	tests := []struct {
+		name     string
+		atLeast  int
+		problem  string
+		warnings int
+	}{
+		{"all", 0, `job "test" would not be created`, 0},
+		{"any", 1, "", 1},
+		{"at least 2", 2, "only 1 of the jobs would be created by the pipeline, 2 are needed, missing: test", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := cli.Preflight(pipeline, []string{"build", "test"}, tt.atLeast)
+			err := report.Err()
+			switch {
+			case tt.problem == "" && err != nil:
+				t.Errorf("unexpected problems: %v", err)
+			case tt.problem != "" && (err == nil || !strings.Contains(err.Error(), tt.problem)):
+				t.Errorf("err = %v, want %q", err, tt.problem)
+			}
+			if len(report.Warnings) != tt.warnings {
+				t.Errorf("warnings = %v, want %d", report.Warnings, tt.warnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package gitlab
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// Project identifies a project by its numeric ID, or by its full path
+// when the credentials do not allow to resolve the ID.
+type Project struct {
+	ID   int
+	Path string
+}
+
+// pid returns the project identifier accepted by go-gitlab services.
+func (p *Project) pid() interface{} {
+	if p.ID != 0 {
+		return p.ID
+	}
+	return p.Path
+}
+
+// urlPath returns the project identifier escaped for raw API request paths.
+func (p *Project) urlPath() string {
+	if p.ID != 0 {
+		return strconv.Itoa(p.ID)
+	}
+	return gitlab.PathEscape(p.Path)
+}
+
+func (p *Project) String() string {
+	if p.Path != "" {
+		return p.Path
+	}
+	return strconv.Itoa(p.ID)
+}
+
+// ResolveProject looks up a project given by its numeric ID or by its full
+// path with any depth of nested groups, e.g. `group/subgroup/repo`.
+func (cli *GitlabClient) ResolveProject(ref string) (*Project, error) {
+	ref = strings.Trim(ref, "/")
+	if ref == "" {
+		return nil, errEmptyProject
+	}
+
+	if err := cli.allowed(opReadProject); err != nil {
+		// The trigger endpoint checks the project by itself.
+		if id, err := strconv.Atoi(ref); err == nil {
+			return &Project{ID: id}, nil
+		}
+		return &Project{Path: ref}, nil
+	}
+
+	project, _, err := cli.Projects.GetProject(ref, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Project{ID: project.ID, Path: project.PathWithNamespace}, nil
+}
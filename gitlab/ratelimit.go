@@ -0,0 +1,99 @@
+package gitlab
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimiter spreads the requests of one or more clients out to a given
+// rate. It also holds every request back once GitLab tells that its rate
+// limit is exhausted, until the limit is reset.
+type RateLimiter struct {
+	limiter *rate.Limiter
+
+	mu sync.Mutex
+	// Requests wait until then.
+	pausedUntil time.Time
+}
+
+// NewRateLimiter allows perSecond requests per second with bursts of burst
+// requests. The rate is unlimited when perSecond is 0.
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	limit := rate.Limit(perSecond)
+	if perSecond <= 0 {
+		limit = rate.Inf
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{limiter: rate.NewLimiter(limit, burst)}
+}
+
+// Wait blocks until a request may be sent or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	pause := time.Until(l.pausedUntil)
+	l.mu.Unlock()
+	if pause > 0 {
+		timer := time.NewTimer(pause)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return l.limiter.Wait(ctx)
+}
+
+// pause holds the requests back until the time.
+func (l *RateLimiter) pause(until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// serverWait reads how long GitLab asks to wait from the Retry-After header
+// of a 429 or 503 response, or from the RateLimit-* headers once no request
+// is left.
+func serverWait(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return wait
+		}
+	}
+	if resp.StatusCode != http.StatusTooManyRequests && resp.Header.Get("RateLimit-Remaining") != "0" {
+		return 0
+	}
+	if reset, err := strconv.ParseInt(resp.Header.Get("RateLimit-Reset"), 10, 64); err == nil {
+		return time.Until(time.Unix(reset, 0))
+	}
+	if reset, err := http.ParseTime(resp.Header.Get("RateLimit-ResetTime")); err == nil {
+		return time.Until(reset)
+	}
+	return 0
+}
+
+// parseRetryAfter accepts both a number of seconds and an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date), true
+	}
+	return 0, false
+}
@@ -0,0 +1,127 @@
+package gitlab
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy tells how many times and how long apart a request is retried
+// after a network error, a 429 or a 5xx response. Requests which may create
+// something, such as a pipeline, are only retried after a 429.
+type RetryPolicy struct {
+	// Retries after the first attempt, none when 0.
+	MaxRetries int
+	// Wait before the first retry, doubled for every next one up to WaitMax.
+	WaitMin time.Duration
+	WaitMax time.Duration
+	// Longest wait asked by GitLab with Retry-After or RateLimit-Reset which
+	// is honored, the response is returned when it asks for more. No limit
+	// when 0.
+	MaxServerWait time.Duration
+}
+
+// DefaultRetryPolicy matches the retries of go-gitlab.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:    5,
+	WaitMin:       100 * time.Millisecond,
+	WaitMax:       400 * time.Millisecond,
+	MaxServerWait: time.Minute,
+}
+
+func (p RetryPolicy) wait(attempt int) time.Duration {
+	wait := p.WaitMin << attempt
+	if wait > p.WaitMax || wait <= 0 {
+		wait = p.WaitMax
+	}
+	return wait
+}
+
+// retryTransport retries the requests as the policy tells. Every attempt
+// waits for the limiter, which is shared by all the requests of the client.
+type retryTransport struct {
+	policy  RetryPolicy
+	limiter *RateLimiter
+	base    http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.GetBody == nil {
+		// go-gitlab does not tell how to read the body again, the API bodies
+		// are small enough to keep for the retries.
+		content, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(content))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(content)), nil
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		if err := t.limiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+		resp, err := t.base.RoundTrip(req)
+		asked := serverWait(resp)
+		if t.policy.MaxServerWait > 0 && asked > t.policy.MaxServerWait {
+			return resp, err
+		}
+		if asked > 0 {
+			// Other requests of the client hold back as well.
+			t.limiter.pause(time.Now().Add(asked))
+		}
+		if attempt >= t.policy.MaxRetries || !t.retryable(req, resp, err) {
+			return resp, err
+		}
+		if req.Body != nil {
+			if req.GetBody == nil {
+				return resp, err
+			}
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return resp, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		// The limiter holds the retry back for as long as the server asked.
+		if asked > 0 {
+			continue
+		}
+		timer := time.NewTimer(t.policy.wait(attempt))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (t *retryTransport) retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	if req.Method == http.MethodPost || req.Method == http.MethodPatch {
+		return false
+	}
+	if err != nil {
+		// A certificate is not going to be trusted on the next attempt.
+		var certErr *tls.CertificateVerificationError
+		return !errors.As(err, &certErr)
+	}
+	return resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented
+}
@@ -0,0 +1,122 @@
+package gitlab
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const defaultTraceLines = 20
+
+var (
+	// GitLab Runner wraps the parts of a job log in collapsible sections,
+	// e.g. section_start:1700000000:step_script\r\x1b[0K.
+	traceSection = regexp.MustCompile(`section_(start|end):\d+:([A-Za-z0-9_.-]+)(\[[^\]]*\])?\r?(\x1b\[0K)?`)
+	traceEscape  = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+)
+
+// Sections the runner opens after the script failed, a failure is never
+// blamed on them.
+var afterFailureSections = map[string]bool{
+	"after_script":                true,
+	"upload_artifacts_on_failure": true,
+	"archive_cache_on_failure":    true,
+	"cleanup_file_variables":      true,
+}
+
+type TraceLine struct {
+	Text string
+	// Innermost section the line belongs to, if any.
+	Section string
+}
+
+// JobTrace is the end of the log of a job.
+type JobTrace struct {
+	Lines []TraceLine
+	// Section the job failed in: the last one opened before the runner
+	// started to clean up.
+	FailedSection string
+}
+
+// GetTraceTail returns the last n lines of the log of the job with the
+// escape sequences and section markers removed.
+func (cli *GitlabClient) GetTraceTail(pipelineInfo *PipelineInfo, job *JobInfo, n int) (*JobTrace, error) {
+	if err := cli.allowed(opReadPipeline); err != nil {
+		return nil, err
+	}
+	trace, _, err := cli.Jobs.GetTraceFile(pipelineInfo.Project.pid(), job.ID)
+	if err != nil {
+		return nil, err
+	}
+	return parseTrace(trace, n)
+}
+
+// failedJobTrace returns the end of the log of a failed job, or nil when the
+// log cannot be read. A failed job is reported without it then.
+func (cli *GitlabClient) failedJobTrace(pipelineInfo *PipelineInfo, job *JobInfo) *JobTrace {
+	if cli.traceLines <= 0 || cli.allowed(opReadPipeline) != nil {
+		return nil
+	}
+	trace, err := cli.GetTraceTail(pipelineInfo, job, cli.traceLines)
+	if err != nil {
+		cli.log.Debug("job log was not read", "job", job.Name, "id", job.ID, "error", err)
+		return nil
+	}
+	return trace
+}
+
+func parseTrace(r io.Reader, n int) (*JobTrace, error) {
+	if n < 0 {
+		n = 0
+	}
+	trace := &JobTrace{}
+	lines := make([]TraceLine, 0, n)
+	open := make([]string, 0)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		raw := scanner.Text()
+		for _, match := range traceSection.FindAllStringSubmatch(raw, -1) {
+			name := match[2]
+			if match[1] == "start" {
+				open = append(open, name)
+				if !afterFailureSections[name] {
+					trace.FailedSection = name
+				}
+				continue
+			}
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == name {
+					open = open[:i]
+					break
+				}
+			}
+		}
+
+		text := traceEscape.ReplaceAllString(traceSection.ReplaceAllString(raw, ""), "")
+		// A carriage return rewrites the line, e.g. for progress output.
+		text = strings.TrimRight(text, "\r")
+		if i := strings.LastIndex(text, "\r"); i >= 0 {
+			text = text[i+1:]
+		}
+		if strings.TrimSpace(text) == "" || n <= 0 {
+			continue
+		}
+
+		line := TraceLine{Text: text}
+		if len(open) != 0 {
+			line.Section = open[len(open)-1]
+		}
+		if len(lines) == n {
+			lines = append(lines[:0], lines[1:]...)
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	trace.Lines = lines
+	return trace, nil
+}
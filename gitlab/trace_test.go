@@ -0,0 +1,114 @@
+package gitlab
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// runnerTrace is the log of a failed job as GitLab Runner writes it.
+const runnerTrace = "\x1b[0KRunning with gitlab-runner 16.5.0 (853330f9)\x1b[0;m\n" +
+	"\x1b[0K  on docker-runner-1 xK3p9a, system ID: s_5b8d6a1f2c3e\x1b[0;m\n" +
+	"section_start:1700000000:prepare_executor\r\x1b[0K\x1b[0K\x1b[36;1mPreparing the \"docker\" executor\x1b[0;m\x1b[0;m\n" +
+	"\x1b[0KUsing Docker executor with image golang:1.21 ...\x1b[0;m\n" +
+	"section_end:1700000003:prepare_executor\r\x1b[0K\n" +
+	"section_start:1700000003:get_sources\r\x1b[0K\x1b[0K\x1b[36;1mGetting source from Git repository\x1b[0;m\x1b[0;m\n" +
+	"Receiving objects:  10% (12/120)\rReceiving objects:  50% (60/120)\rReceiving objects: 100% (120/120), done.\n" +
+	"section_end:1700000005:get_sources\r\x1b[0K\n" +
+	"section_start:1700000005:step_script[collapsed=true]\r\x1b[0K\x1b[0K\x1b[36;1mExecuting \"step_script\" stage of the job script\x1b[0;m\x1b[0;m\n" +
+	"\x1b[32;1m$ go test ./...\x1b[0;m\n" +
+	"--- FAIL: TestParse (0.00s)\n" +
+	"FAIL\n" +
+	"section_end:1700000009:step_script\r\x1b[0K\n" +
+	"section_start:1700000009:after_script\r\x1b[0K\x1b[0K\x1b[36;1mRunning after_script\x1b[0;m\x1b[0;m\n" +
+	"\x1b[32;1m$ make clean\x1b[0;m\n" +
+	"section_end:1700000010:after_script\r\x1b[0K\n" +
+	"section_start:1700000010:cleanup_file_variables\r\x1b[0K\x1b[0K\x1b[36;1mCleaning up project directory and file based variables\x1b[0;m\x1b[0;m\n" +
+	"section_end:1700000011:cleanup_file_variables\r\x1b[0K\n" +
+	"\x1b[31;1mERROR: Job failed: exit code 1\n" +
+	"\x1b[0;m\n"
+
+func TestParseTrace(t *testing.T) {
+	tests := []struct {
+		name   string
+		trace  string
+		n      int
+		lines  []TraceLine
+		failed string
+	}{
+		{
+			name:  "last lines",
+			trace: runnerTrace,
+			n:     5,
+			lines: []TraceLine{
+				{"FAIL", "step_script"},
+				{"Running after_script", "after_script"},
+				{"$ make clean", "after_script"},
+				{"Cleaning up project directory and file based variables", "cleanup_file_variables"},
+				{"ERROR: Job failed: exit code 1", ""},
+			},
+			failed: "step_script",
+		},
+		{
+			name:  "carriage returns",
+			trace: runnerTrace,
+			n:     9,
+			lines: []TraceLine{
+				{"Receiving objects: 100% (120/120), done.", "get_sources"},
+				{"Executing \"step_script\" stage of the job script", "step_script"},
+				{"$ go test ./...", "step_script"},
+				{"--- FAIL: TestParse (0.00s)", "step_script"},
+				{"FAIL", "step_script"},
+				{"Running after_script", "after_script"},
+				{"$ make clean", "after_script"},
+				{"Cleaning up project directory and file based variables", "cleanup_file_variables"},
+				{"ERROR: Job failed: exit code 1", ""},
+			},
+			failed: "step_script",
+		},
+		{
+			name:  "short log",
+			trace: "\x1b[0KRunning with gitlab-runner 16.5.0 (853330f9)\x1b[0;m\n\x1b[31;1mERROR: Job failed: exit code 1\n\x1b[0;m\n",
+			n:     20,
+			lines: []TraceLine{
+				{"Running with gitlab-runner 16.5.0 (853330f9)", ""},
+				{"ERROR: Job failed: exit code 1", ""},
+			},
+		},
+		{
+			name: "nested sections",
+			trace: "section_start:1700000000:step_script\r\x1b[0Kmake\n" +
+				"section_start:1700000001:build\r\x1b[0Kcc -o app main.c\n" +
+				"section_end:1700000002:build\r\x1b[0K\n" +
+				"main.c:3: error\n",
+			n: 20,
+			lines: []TraceLine{
+				{"make", "step_script"},
+				{"cc -o app main.c", "build"},
+				{"main.c:3: error", "step_script"},
+			},
+			failed: "build",
+		},
+		{
+			name:   "no lines",
+			trace:  runnerTrace,
+			n:      0,
+			lines:  []TraceLine{},
+			failed: "step_script",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trace, err := parseTrace(strings.NewReader(tt.trace), tt.n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(trace.Lines, tt.lines) {
+				t.Errorf("lines = %q, want %q", trace.Lines, tt.lines)
+			}
+			if trace.FailedSection != tt.failed {
+				t.Errorf("failed section = %q, want %q", trace.FailedSection, tt.failed)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package gitlab
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+// InsecureSkipVerifyWarning is logged whenever the server certificate is not
+// verified.
+const InsecureSkipVerifyWarning = "!!! TLS CERTIFICATE VERIFICATION IS DISABLED: anyone on the network can intercept the token and the artifacts, only use this in a lab !!!"
+
+// TransportConfig tells how to reach a GitLab instance behind an internal
+// CA, a proxy or a client certificate check.
+type TransportConfig struct {
+	// PEM bundle of the CAs trusted besides the system ones.
+	CAFile string
+	// PEM client certificate and key, for instances which require mTLS.
+	CertFile string
+	KeyFile  string
+	// Proxy the requests go through. HTTPS_PROXY, HTTP_PROXY and NO_PROXY
+	// are used when empty.
+	ProxyURL string
+	// Unix socket every request is sent to, the host of the URL is then
+	// only sent in the Host header.
+	UnixSocket string
+	// InsecureSkipVerify accepts any server certificate.
+	InsecureSkipVerify bool
+}
+
+// NewTransport returns a pooled transport configured as cfg tells.
+func NewTransport(cfg TransportConfig) (*http.Transport, error) {
+	transport := cleanhttp.DefaultPooledTransport()
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		bundle, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidCAFile, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("%w: no certificate in %s", errInvalidCAFile, cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return nil, errClientCertKey
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidClientCert, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if cfg.ProxyURL != "" {
+		proxy, err := url.Parse(cfg.ProxyURL)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("%w: %q", errInvalidProxy, cfg.ProxyURL)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if cfg.UnixSocket != "" {
+		dialer := &net.Dialer{Timeout: 30 * time.Second}
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", cfg.UnixSocket)
+		}
+	}
+	return transport, nil
+}
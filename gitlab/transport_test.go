@@ -0,0 +1,264 @@
+package gitlab
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA issues the certificates of the TLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+	// PEM file of the CA certificate.
+	file string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &testCA{cert: cert, key: key, pool: x509.NewCertPool(), file: filepath.Join(t.TempDir(), "ca.pem")}
+	ca.pool.AddCert(cert)
+	writePEM(t, ca.file, "CERTIFICATE", der)
+	return ca
+}
+
+// issue returns a certificate for the server or the client, and its PEM
+// certificate and key files.
+func (ca *testCA) issue(t *testing.T, usage x509.ExtKeyUsage) (tls.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, certFile, keyFile
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTLSServer returns a server to start with StartTLS, which does not log
+// the handshakes the tests make fail.
+func newTLSServer() *httptest.Server {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	return srv
+}
+
+// getThrough sends a request through a transport configured as cfg tells.
+func getThrough(t *testing.T, cfg TransportConfig, url string) error {
+	t.Helper()
+	transport, err := NewTransport(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.CloseIdleConnections()
+	resp, err := (&http.Client{Transport: transport, Timeout: 5 * time.Second}).Get(url)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func TestNewTransportCABundle(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert, _, _ := ca.issue(t, x509.ExtKeyUsageServerAuth)
+	srv := newTLSServer()
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	if err := getThrough(t, TransportConfig{}, srv.URL); err == nil {
+		t.Error("the server certificate was trusted without the CA bundle")
+	}
+	if err := getThrough(t, TransportConfig{CAFile: ca.file}, srv.URL); err != nil {
+		t.Errorf("request with the CA bundle: %v", err)
+	}
+	if err := getThrough(t, TransportConfig{InsecureSkipVerify: true}, srv.URL); err != nil {
+		t.Errorf("request without verification: %v", err)
+	}
+
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := NewTransport(TransportConfig{CAFile: notPEM})
+	if !errors.Is(err, errInvalidCAFile) {
+		t.Errorf("err = %v, want an invalid CA bundle", err)
+	}
+	_, err = NewTransport(TransportConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")})
+	if !errors.Is(err, errInvalidCAFile) || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("err = %v, want an invalid CA bundle which does not exist", err)
+	}
+}
+
+func TestNewTransportClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert, _, _ := ca.issue(t, x509.ExtKeyUsageServerAuth)
+	_, certFile, keyFile := ca.issue(t, x509.ExtKeyUsageClientAuth)
+	_, _, otherKeyFile := ca.issue(t, x509.ExtKeyUsageClientAuth)
+	srv := newTLSServer()
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.pool,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	if err := getThrough(t, TransportConfig{CAFile: ca.file}, srv.URL); err == nil {
+		t.Error("the server accepted a request without a client certificate")
+	}
+	if err := getThrough(t, TransportConfig{CAFile: ca.file, CertFile: certFile, KeyFile: keyFile}, srv.URL); err != nil {
+		t.Errorf("request with the client certificate: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		certFile string
+		keyFile  string
+		err      error
+	}{
+		{"certificate alone", certFile, "", errClientCertKey},
+		{"key alone", "", keyFile, errClientCertKey},
+		{"key of another certificate", certFile, otherKeyFile, errInvalidClientCert},
+		{"missing files", certFile + ".missing", keyFile, errInvalidClientCert},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTransport(TransportConfig{CertFile: tt.certFile, KeyFile: tt.keyFile})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("err = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNewTransportProxy(t *testing.T) {
+	// A proxy gets the whole URL of the request.
+	proxied := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied <- r.URL.String()
+	}))
+	defer proxy.Close()
+	if err := getThrough(t, TransportConfig{ProxyURL: proxy.URL}, "http://gitlab.invalid/api/v4/version"); err != nil {
+		t.Fatal(err)
+	}
+	if url := <-proxied; url != "http://gitlab.invalid/api/v4/version" {
+		t.Errorf("proxy got %q, want the GitLab URL", url)
+	}
+
+	tests := []struct {
+		proxyURL string
+		valid    bool
+	}{
+		{"http://proxy.internal:3128", true},
+		{"socks5://proxy.internal:1080", true},
+		{"proxy.internal:3128", false},
+		{"http://", false},
+		{"://proxy.internal", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.proxyURL, func(t *testing.T) {
+			_, err := NewTransport(TransportConfig{ProxyURL: tt.proxyURL})
+			if tt.valid && err != nil {
+				t.Errorf("err = %v, want none", err)
+			}
+			if !tt.valid && !errors.Is(err, errInvalidProxy) {
+				t.Errorf("err = %v, want an invalid proxy URL", err)
+			}
+		})
+	}
+}
+
+func TestNewTransportUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "gitlab.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets are not supported: %v", err)
+	}
+	hosts := make(chan string, 1)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts <- r.Host
+	}))
+	srv.Listener = listener
+	srv.Start()
+	defer srv.Close()
+
+	// The socket wins over any proxy.
+	cfg := TransportConfig{UnixSocket: socket, ProxyURL: "http://proxy.invalid:3128"}
+	if err := getThrough(t, cfg, "http://gitlab.example.com/api/v4/version"); err != nil {
+		t.Fatal(err)
+	}
+	if host := <-hosts; host != "gitlab.example.com" {
+		t.Errorf("host %q, want the one of the URL", host)
+	}
+}
@@ -1,22 +1,12 @@
 package gitlab
 
-import "fmt"
-
-func makeProjectId(project, repo string) string {
-	return fmt.Sprintf(
-		"%s/%s",
-		project,
-		repo,
-	)
-}
-
 func isFinishedJob(state string) (bool, error) {
 	switch state {
 	case Success:
 		return true, nil
 	case Failed, Canceled, Manual, Skipped:
 		return true, errNotSuccessfulJob
-	case Running, Pending:
+	case Created, Pending, Preparing, Scheduled, WaitingForResource, Running:
 		return false, nil
 	default:
 		return false, errUnrecognizeJobStatus